@@ -0,0 +1,190 @@
+package requests
+
+import (
+	"context"
+	"errors"
+	"io"
+	"iter"
+	"net/http"
+	"sync"
+)
+
+// Call describes a single request in a batch.
+type Call struct {
+	Method string
+	URL    string
+	Opts   []Option
+}
+
+// Result holds the outcome of a Call. Index is the position of the Call in the input slice.
+type Result struct {
+	Index    int
+	Response *Response
+	Err      error
+}
+
+// BatchOption configures batch execution.
+type BatchOption func(*batchConfig)
+
+type batchConfig struct {
+	failFast bool
+}
+
+// WithFailFast cancels outstanding calls after the first error.
+// Calls that never started report the cancellation as their error; responses
+// that already arrived keep readable bodies.
+func WithFailFast() BatchOption {
+	return func(c *batchConfig) {
+		c.failFast = true
+	}
+}
+
+type sendFunc func(ctx context.Context, method, url string, opts ...Option) (*Response, error)
+
+// Batch sends calls with at most concurrency requests in flight and returns results in input order.
+// concurrency <= 0 sends all calls at once. By default every call runs and the returned error joins
+// all call errors; with WithFailFast the first error is returned and remaining calls are cancelled.
+// Callers own the returned responses and should read or close their bodies; the bodies stay
+// readable after Batch returns and are bound to ctx.
+func Batch(ctx context.Context, calls []Call, concurrency int, opts ...BatchOption) ([]Result, error) {
+	return runBatch(ctx, do, calls, concurrency, opts)
+}
+
+// BatchIter is like Batch but yields results as they complete.
+// Breaking out of the loop cancels calls that are still pending.
+func BatchIter(ctx context.Context, calls []Call, concurrency int, opts ...BatchOption) iter.Seq[Result] {
+	return iterBatch(ctx, do, calls, concurrency, opts)
+}
+
+// Batch sends calls using session defaults. See Batch.
+func (s *Session) Batch(ctx context.Context, calls []Call, concurrency int, opts ...BatchOption) ([]Result, error) {
+	return runBatch(ctx, s.do, calls, concurrency, opts)
+}
+
+// BatchIter sends calls using session defaults. See BatchIter.
+func (s *Session) BatchIter(ctx context.Context, calls []Call, concurrency int, opts ...BatchOption) iter.Seq[Result] {
+	return iterBatch(ctx, s.do, calls, concurrency, opts)
+}
+
+func runBatch(ctx context.Context, send sendFunc, calls []Call, concurrency int, opts []BatchOption) ([]Result, error) {
+	cfg := newBatchConfig(opts)
+	dispatch, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([]Result, len(calls))
+	var first error
+	for res := range startBatch(ctx, dispatch, cancel, send, calls, concurrency, cfg) {
+		results[res.Index] = res
+		if res.Err != nil && first == nil {
+			first = res.Err
+		}
+	}
+	if cfg.failFast {
+		return results, first
+	}
+	var errs []error
+	for _, res := range results {
+		if res.Err != nil {
+			errs = append(errs, res.Err)
+		}
+	}
+	return results, errors.Join(errs...)
+}
+
+func iterBatch(ctx context.Context, send sendFunc, calls []Call, concurrency int, opts []BatchOption) iter.Seq[Result] {
+	cfg := newBatchConfig(opts)
+	return func(yield func(Result) bool) {
+		dispatch, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		ch := startBatch(ctx, dispatch, cancel, send, calls, concurrency, cfg)
+		for res := range ch {
+			if !yield(res) || (cfg.failFast && res.Err != nil) {
+				cancel()
+				go drainBatch(ch)
+				return
+			}
+		}
+	}
+}
+
+func newBatchConfig(opts []BatchOption) batchConfig {
+	var cfg batchConfig
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&cfg)
+		}
+	}
+	return cfg
+}
+
+// startBatch dispatches calls and returns a channel that is closed once every call has reported.
+// The channel is buffered so workers never block on a consumer that stopped reading.
+//
+// Cancelling dispatch stops new calls and cancels the ones still in flight. Each call runs
+// with its own context derived from ctx, so calls that already finished keep a readable
+// body; that context is released when the body is closed.
+func startBatch(ctx, dispatch context.Context, cancel context.CancelFunc, send sendFunc, calls []Call, concurrency int, cfg batchConfig) <-chan Result {
+	if concurrency <= 0 || concurrency > len(calls) {
+		concurrency = len(calls)
+	}
+	ch := make(chan Result, len(calls))
+	sem := make(chan struct{}, max(concurrency, 1))
+
+	go func() {
+		var wg sync.WaitGroup
+		defer func() {
+			wg.Wait()
+			close(ch)
+		}()
+		for i, c := range calls {
+			select {
+			case sem <- struct{}{}:
+			case <-dispatch.Done():
+			}
+			if err := dispatch.Err(); err != nil {
+				for j := i; j < len(calls); j++ {
+					ch <- Result{Index: j, Err: classifyErr(err)}
+				}
+				return
+			}
+			wg.Go(func() {
+				defer func() { <-sem }()
+				callCtx, callCancel := context.WithCancel(ctx)
+				stop := context.AfterFunc(dispatch, callCancel)
+				resp, err := send(callCtx, c.Method, c.URL, c.Opts...)
+				stop()
+				if resp != nil && resp.Raw != nil && resp.Raw.Body != nil && resp.Raw.Body != http.NoBody {
+					resp.Raw.Body = &releaseBody{ReadCloser: resp.Raw.Body, release: callCancel}
+				} else {
+					callCancel()
+				}
+				ch <- Result{Index: i, Response: resp, Err: err}
+				if err != nil && cfg.failFast {
+					cancel()
+				}
+			})
+		}
+	}()
+	return ch
+}
+
+func drainBatch(ch <-chan Result) {
+	for res := range ch {
+		if res.Response != nil && res.Response.Raw != nil && res.Response.Raw.Body != nil {
+			_ = res.Response.Raw.Body.Close()
+		}
+	}
+}
+
+// releaseBody releases the context of a batch call once its body is closed.
+type releaseBody struct {
+	io.ReadCloser
+	release context.CancelFunc
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
@@ -0,0 +1,126 @@
+package requests
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Codec marshals and unmarshals bodies for a media type.
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+	ContentType() string
+}
+
+const mediaTypeJSON = "application/json"
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{
+		mediaTypeJSON:                       JSONCodec{},
+		"application/xml":                   XMLCodec{},
+		"text/xml":                          XMLCodec{},
+		"application/x-www-form-urlencoded": FormCodec{},
+	}
+)
+
+// RegisterCodec registers c for mediaType, replacing any existing codec.
+// Registering "application/json" swaps the codec used by WithJSON and Response.JSON.
+func RegisterCodec(mediaType string, c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[strings.ToLower(mediaType)] = c
+}
+
+// CodecFor returns the codec registered for the media type of contentType.
+// Structured syntax suffixes such as "+json" and "+xml" fall back to the base codec.
+func CodecFor(contentType string) (Codec, bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, false
+	}
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	if c, ok := codecs[mediaType]; ok {
+		return c, true
+	}
+	if i := strings.LastIndexByte(mediaType, '+'); i >= 0 {
+		c, ok := codecs["application/"+mediaType[i+1:]]
+		return c, ok
+	}
+	return nil, false
+}
+
+func jsonCodec() Codec {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	return codecs[mediaTypeJSON]
+}
+
+// JSONCodec encodes bodies with encoding/json.
+type JSONCodec struct{}
+
+func (JSONCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (JSONCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+func (JSONCodec) ContentType() string                { return mediaTypeJSON }
+
+// XMLCodec encodes bodies with encoding/xml.
+type XMLCodec struct{}
+
+func (XMLCodec) Marshal(v any) ([]byte, error)      { return xml.Marshal(v) }
+func (XMLCodec) Unmarshal(data []byte, v any) error { return xml.Unmarshal(data, v) }
+func (XMLCodec) ContentType() string                { return "application/xml" }
+
+// FormCodec encodes url-encoded form bodies.
+// Marshal accepts url.Values, map[string]string, map[string][]string or a struct with `url` tags.
+// Unmarshal accepts *url.Values, *map[string]string or *map[string][]string.
+type FormCodec struct{}
+
+func (FormCodec) Marshal(v any) ([]byte, error) {
+	var values url.Values
+	switch t := v.(type) {
+	case url.Values:
+		values = t
+	case map[string][]string:
+		values = t
+	case map[string]string:
+		values = make(url.Values, len(t))
+		for k, s := range t {
+			values.Set(k, s)
+		}
+	default:
+		var err error
+		if values, err = encodeValues(v); err != nil {
+			return nil, err
+		}
+	}
+	return []byte(values.Encode()), nil
+}
+
+func (FormCodec) Unmarshal(data []byte, v any) error {
+	values, err := url.ParseQuery(string(data))
+	if err != nil {
+		return err
+	}
+	switch t := v.(type) {
+	case *url.Values:
+		*t = values
+	case *map[string][]string:
+		*t = values
+	case *map[string]string:
+		*t = make(map[string]string, len(values))
+		for k := range values {
+			(*t)[k] = values.Get(k)
+		}
+	default:
+		return fmt.Errorf("form codec: unsupported type %T", v)
+	}
+	return nil
+}
+
+func (FormCodec) ContentType() string { return "application/x-www-form-urlencoded" }
@@ -0,0 +1,226 @@
+package requests
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// CurlOption configures curl command rendering.
+type CurlOption func(*curlConfig)
+
+type curlConfig struct {
+	redact    bool
+	extra     []string
+	multiline bool
+}
+
+// CurlRedact replaces sensitive header values, query parameters and URL passwords with REDACTED.
+// names adds header names to the default sensitive set.
+func CurlRedact(names ...string) CurlOption {
+	return func(c *curlConfig) {
+		c.redact = true
+		c.extra = append(c.extra, names...)
+	}
+}
+
+// CurlMultiline puts each flag and its value on its own continuation line.
+func CurlMultiline() CurlOption {
+	return func(c *curlConfig) {
+		c.multiline = true
+	}
+}
+
+// ToCurl renders the request as a curl command.
+// The body is buffered so the Request can still be sent afterwards with Do.
+func (r *Request) ToCurl(opts ...CurlOption) (string, error) {
+	if r.err != nil {
+		return "", fmt.Errorf("%w: %v", ErrRequest, r.err)
+	}
+	var body []byte
+	if r.body != nil {
+		rb, err := r.requestBody()
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", ErrRequest, err)
+		}
+		b, err := io.ReadAll(rb)
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", ErrRequest, err)
+		}
+		r.body = bytes.NewReader(b)
+		body = b
+	}
+	httpReq, err := r.newHTTPRequest(context.Background())
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrRequest, err)
+	}
+	return renderCurl(r, httpReq, body, newCurlConfig(opts)), nil
+}
+
+// CurlCommand renders the request that produced the response as a curl command.
+// Bodies set from byte slices, strings or the encoding options are included; bodies
+// from other readers were consumed when sending and are omitted.
+func (r *Response) CurlCommand(opts ...CurlOption) (string, error) {
+	if r == nil || r.req == nil || r.sent == nil {
+		return "", ErrResponseNil
+	}
+	var body []byte
+	if r.sent.GetBody != nil {
+		rc, err := r.sent.GetBody()
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", ErrResponse, err)
+		}
+		defer rc.Close()
+		if body, err = io.ReadAll(rc); err != nil {
+			return "", fmt.Errorf("%w: %v", ErrResponse, err)
+		}
+	}
+	return renderCurl(r.req, r.sent, body, newCurlConfig(opts)), nil
+}
+
+func newCurlConfig(opts []CurlOption) curlConfig {
+	var cfg curlConfig
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&cfg)
+		}
+	}
+	return cfg
+}
+
+func renderCurl(r *Request, req *http.Request, body []byte, cfg curlConfig) string {
+	// Each group is a flag with its value, rendered together on multiline output.
+	groups := [][]string{{"curl"}}
+	add := func(args ...string) {
+		groups = append(groups, args)
+	}
+	switch {
+	case req.Method == http.MethodHead:
+		add("--head")
+	case req.Method != http.MethodGet || len(body) > 0:
+		add("-X", req.Method)
+	}
+
+	rawURL := req.URL.String()
+	if cfg.redact {
+		rawURL = redactURL(req.URL)
+	}
+	add(shellQuote(rawURL))
+
+	keys := make([]string, 0, len(req.Header))
+	for k := range req.Header {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		for _, v := range req.Header[k] {
+			if k == "Accept-Encoding" && len(r.decompress) > 0 && v == r.acceptEncoding() {
+				// --compressed sends its own Accept-Encoding.
+				continue
+			}
+			if cfg.redact && isSensitiveName(k, cfg.extra) {
+				v = redacted
+			}
+			add("-H", shellQuote(k+": "+v))
+		}
+	}
+	if len(body) > 0 {
+		add("--data-binary", shellQuote(string(body)))
+	}
+
+	if r.proxy != nil {
+		proxy := r.proxy.String()
+		if cfg.redact {
+			proxy = r.proxy.Redacted()
+		}
+		add("-x", shellQuote(proxy))
+	}
+	for _, k := range sortedKeys(r.proxyConnectHeader, strings.Compare) {
+		for _, v := range r.proxyConnectHeader[k] {
+			if cfg.redact && isSensitiveName(k, cfg.extra) {
+				v = redacted
+			}
+			add("--proxy-header", shellQuote(k+": "+v))
+		}
+	}
+	for _, hostPort := range sortedKeys(r.resolve, strings.Compare) {
+		host, port, _ := net.SplitHostPort(hostPort)
+		toHost, toPort, _ := net.SplitHostPort(r.resolve[hostPort])
+		if strings.Contains(toHost, ":") {
+			toHost = "[" + toHost + "]"
+		}
+		if toPort == port {
+			add("--resolve", shellQuote(host+":"+port+":"+toHost))
+		} else {
+			add("--connect-to", shellQuote(host+":"+port+":"+toHost+":"+toPort))
+		}
+	}
+	if r.unixSocket != "" {
+		add("--unix-socket", shellQuote(r.unixSocket))
+	}
+	if p := r.protocols; p != nil {
+		switch {
+		case p.UnencryptedHTTP2():
+			add("--http2-prior-knowledge")
+		case p.HTTP2() && !p.HTTP1():
+			add("--http2")
+		case p.HTTP1() && !p.HTTP2():
+			add("--http1.1")
+		}
+	}
+	if r.tlsConfig != nil && r.tlsConfig.InsecureSkipVerify {
+		add("-k")
+	}
+	if len(r.decompress) > 0 {
+		add("--compressed")
+	}
+	switch p := r.redirectPolicy; {
+	case p != nil && p.MaxHops >= 0:
+		add("-L")
+		if p.MaxHops > 0 {
+			add("--max-redirs", strconv.Itoa(p.MaxHops))
+		}
+		if p.PreserveMethod {
+			add("--post301")
+			add("--post302")
+		}
+		if len(p.AllowedSchemes) > 0 {
+			add("--proto-redir", shellQuote("="+strings.Join(p.AllowedSchemes, ",")))
+		}
+	case p != nil:
+	case r.redirectMax == nil:
+		add("-L")
+	case *r.redirectMax > 0:
+		add("-L")
+		add("--max-redirs", strconv.Itoa(*r.redirectMax))
+	}
+	if r.timeout > 0 {
+		add("--max-time", strconv.FormatFloat(r.timeout.Seconds(), 'f', -1, 64))
+	}
+
+	sep := " "
+	if cfg.multiline {
+		sep = " \\\n  "
+	}
+	parts := make([]string, len(groups))
+	for i, g := range groups {
+		parts[i] = strings.Join(g, " ")
+	}
+	return strings.Join(parts, sep)
+}
+
+// shellQuote quotes s for POSIX shells unless it only contains safe characters.
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./:=@,+%", r))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,226 @@
+package requests
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Decoder returns a reader that decodes r, which holds a body with a single content coding applied.
+type Decoder func(r io.Reader) (io.ReadCloser, error)
+
+// defaultEncodings are advertised by WithDecompression when called without arguments.
+var defaultEncodings = []string{"gzip", "deflate", "br", "zstd"}
+
+var (
+	decodersMu sync.RWMutex
+	decoders   = map[string]Decoder{
+		"gzip":    decodeGzip,
+		"x-gzip":  decodeGzip,
+		"deflate": decodeDeflate,
+		"br":      decodeBrotli,
+		"zstd":    decodeZstd,
+	}
+)
+
+// RegisterDecoder registers dec for the content coding name, replacing any existing decoder.
+func RegisterDecoder(encoding string, dec Decoder) {
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+	decoders[strings.ToLower(encoding)] = dec
+}
+
+func decoderFor(encoding string) (Decoder, bool) {
+	decodersMu.RLock()
+	defer decodersMu.RUnlock()
+	dec, ok := decoders[strings.ToLower(encoding)]
+	return dec, ok
+}
+
+// WithDecompression advertises encodings in Accept-Encoding, unless the header is set,
+// and decodes response bodies that use them, including stacked codings such as "gzip, br".
+// Without arguments it accepts gzip, deflate, br and zstd. Encodings must have a decoder,
+// either built in or added with RegisterDecoder before the option is created. Bodies are decoded before middlewares see
+// them; HEAD, 204 and 304 responses are left as they are.
+func WithDecompression(encodings ...string) Option {
+	if len(encodings) == 0 {
+		encodings = defaultEncodings
+	}
+	accept := make([]string, 0, len(encodings))
+	var err error
+	for _, enc := range encodings {
+		enc = strings.ToLower(strings.TrimSpace(enc))
+		if _, ok := decoderFor(enc); !ok {
+			err = fmt.Errorf("unsupported content encoding %q", enc)
+			break
+		}
+		if !slices.Contains(accept, enc) {
+			accept = append(accept, enc)
+		}
+	}
+	return func(r *Request) {
+		if r.err != nil {
+			return
+		}
+		if err != nil {
+			r.err = err
+			return
+		}
+		r.decompress = accept
+	}
+}
+
+// WithDecompressGzip enables gzip auto-decompression for response bodies.
+//
+// Deprecated: use WithDecompression("gzip").
+func WithDecompressGzip() Option {
+	return WithDecompression("gzip")
+}
+
+// acceptEncoding is the Accept-Encoding value advertised for WithDecompression.
+func (r *Request) acceptEncoding() string {
+	return strings.Join(r.decompress, ", ")
+}
+
+// decoding decodes responses from next, so middlewares see decoded bodies.
+func decoding(next RoundTripperFunc, accepted []string) RoundTripperFunc {
+	return func(req *http.Request) (*http.Response, error) {
+		resp, err := next(req)
+		if err != nil || resp.Uncompressed {
+			return resp, err
+		}
+		if err := decodeResponse(resp, accepted); err != nil {
+			return nil, err
+		}
+		return resp, nil
+	}
+}
+
+// decodeResponse replaces the body of resp with its decoded content. Codings are
+// removed from the end of Content-Encoding while they are accepted by the request;
+// any that remain are left in the header and the body stays encoded with them.
+func decodeResponse(resp *http.Response, accepted []string) error {
+	if !hasBody(resp) {
+		return nil
+	}
+	var codings []string
+	for _, c := range strings.Split(strings.Join(resp.Header.Values("Content-Encoding"), ","), ",") {
+		if c = strings.ToLower(strings.TrimSpace(c)); c != "" && c != "identity" {
+			codings = append(codings, c)
+		}
+	}
+	body := &decodedBody{Reader: resp.Body, closers: []io.Closer{resp.Body}}
+	n := len(codings)
+	for ; n > 0; n-- {
+		enc := codings[n-1]
+		if !slices.Contains(accepted, enc) && !(enc == "x-gzip" && slices.Contains(accepted, "gzip")) {
+			break
+		}
+		dec, ok := decoderFor(enc)
+		if !ok {
+			break
+		}
+		rc, err := dec(body.Reader)
+		if errors.Is(err, io.EOF) {
+			// Empty bodies of unknown length are only detected here.
+			rc, err = io.NopCloser(strings.NewReader("")), nil
+		}
+		if err != nil {
+			_ = body.Close()
+			return fmt.Errorf("%w: %s: %v", ErrResponse, enc, err)
+		}
+		body.Reader = rc
+		body.closers = append(body.closers, rc)
+	}
+	if n == len(codings) {
+		return nil
+	}
+	resp.Body = body
+	if n == 0 {
+		resp.Header.Del("Content-Encoding")
+	} else {
+		resp.Header.Set("Content-Encoding", strings.Join(codings[:n], ", "))
+	}
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return nil
+}
+
+// hasBody reports whether resp can carry content. HEAD, 204 and 304 responses keep
+// their Content-Encoding but have an empty body.
+func hasBody(resp *http.Response) bool {
+	switch {
+	case resp.Body == nil || resp.Body == http.NoBody || resp.ContentLength == 0:
+		return false
+	case resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotModified:
+		return false
+	case resp.Request != nil && resp.Request.Method == http.MethodHead:
+		return false
+	}
+	return true
+}
+
+// decodedBody reads through a chain of decoders and closes them and the underlying body.
+type decodedBody struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (b *decodedBody) Close() error {
+	var errs []error
+	for i := len(b.closers) - 1; i >= 0; i-- {
+		errs = append(errs, b.closers[i].Close())
+	}
+	return errors.Join(errs...)
+}
+
+func decodeGzip(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// decodeDeflate accepts zlib-wrapped data as specified for HTTP and the raw
+// deflate streams some servers send instead.
+func decodeDeflate(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	hdr, err := br.Peek(2)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if len(hdr) == 2 && hdr[0]&0x0f == 8 && (uint16(hdr[0])<<8|uint16(hdr[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
+
+func decodeBrotli(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(brotli.NewReader(r)), nil
+}
+
+func decodeZstd(r io.Reader) (io.ReadCloser, error) {
+	d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return zstdReader{d}, nil
+}
+
+type zstdReader struct {
+	*zstd.Decoder
+}
+
+func (z zstdReader) Close() error {
+	z.Decoder.Close()
+	return nil
+}
@@ -1,6 +1,16 @@
 package requests
 
-import "fmt"
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
 
 var (
 	// ErrRequest indicates a request build or configuration error.
@@ -9,8 +19,10 @@ var (
 	ErrNetwork = fmt.Errorf("network error")
 	// ErrTimeout indicates a timeout error.
 	ErrTimeout = fmt.Errorf("timeout")
-	// ErrStatus indicates a non-2xx HTTP status.
+	// ErrStatus indicates an HTTP status not accepted as success.
 	ErrStatus = fmt.Errorf("unexpected status")
+	// ErrRedirect indicates a redirect rejected by a RedirectPolicy.
+	ErrRedirect = fmt.Errorf("redirect rejected")
 	// ErrResponse indicates a response read or decode error.
 	ErrResponse = fmt.Errorf("response error")
 	// ErrResponseNil indicates a nil response or body.
@@ -19,16 +31,204 @@ var (
 	ErrNoContent = fmt.Errorf("empty response body")
 )
 
-// StatusError is returned for non-2xx responses.
+// maxErrorSnippet bounds the body excerpt included in StatusError messages.
+const maxErrorSnippet = 256
+
+// maxErrorBody bounds how much of a response body is read to decode problem details or an
+// error result. Longer bodies are not decoded.
+const maxErrorBody = 1 << 20
+
+// StatusError is returned for responses whose status is not accepted as success (non-2xx by default).
+// Problem is set when the response carries an application/problem+json body.
+// Result holds the body decoded by WithErrorResult or WithErrorDecoder; if it
+// implements error it can be extracted with errors.As. Bodies are only decoded up to
+// 1 MiB. Without decoding, only the start of the body is read for the message; the body
+// of Response is closed once it has been read completely, otherwise callers should close it.
 type StatusError struct {
 	StatusCode int
 	Response   *Response
+	Problem    *ProblemDetails
+	Result     any
+
+	snippet string
+}
+
+// newStatusError reads at most maxErrorBody bytes when the body is decoded and a snippet
+// otherwise. A body that is read completely is cached and closed; the unread rest of a
+// longer body stays readable after the bytes already read.
+func newStatusError(req *Request, resp *Response) *StatusError {
+	se := &StatusError{StatusCode: resp.StatusCode, Response: resp}
+	if resp.Raw == nil || resp.Raw.Body == nil {
+		return se
+	}
+	problem := isProblemJSON(resp.Headers.Get("Content-Type"))
+	limit := maxErrorSnippet + utf8.UTFMax
+	if problem || req.errorDecoder != nil {
+		limit = maxErrorBody
+	}
+	b, complete := readErrorBody(resp, limit)
+	if len(b) == 0 {
+		return se
+	}
+	if complete && problem {
+		var p ProblemDetails
+		if json.Unmarshal(b, &p) == nil {
+			se.Problem = &p
+		}
+	}
+	if complete && req.errorDecoder != nil {
+		se.Result = req.errorDecoder(resp)
+	}
+	if !complete {
+		// Drop a rune cut off by the read limit.
+		for i := len(b) - 1; i >= 0 && i >= len(b)-utf8.UTFMax; i-- {
+			if utf8.RuneStart(b[i]) {
+				if !utf8.FullRune(b[i:]) {
+					b = b[:i]
+				}
+				break
+			}
+		}
+	}
+	se.snippet = bodySnippet(b, maxErrorSnippet)
+	if !complete && se.snippet != "" && !strings.HasSuffix(se.snippet, "...") {
+		se.snippet += "..."
+	}
+	return se
+}
+
+// readErrorBody reads up to limit bytes of the body of resp and reports whether that was all
+// of it. Complete bodies are cached for Bytes and closed; otherwise the bytes read are put
+// back in front of the rest of the body.
+func readErrorBody(resp *Response, limit int) ([]byte, bool) {
+	body := resp.Raw.Body
+	b, err := io.ReadAll(io.LimitReader(body, int64(limit)+1))
+	if err != nil || len(b) > limit {
+		resp.Raw.Body = &readCloser{Reader: io.MultiReader(bytes.NewReader(b), body), Closer: body}
+		return b[:min(len(b), limit)], false
+	}
+	resp.once.Do(func() {
+		resp.body = b
+		_ = body.Close()
+	})
+	resp.Raw.Body = http.NoBody
+	return b, true
+}
+
+// readCloser reads from Reader and closes Closer.
+type readCloser struct {
+	io.Reader
+	io.Closer
 }
 
 func (e *StatusError) Error() string {
-	return fmt.Sprintf("unexpected status: %d", e.StatusCode)
+	msg := fmt.Sprintf("unexpected status: %d", e.StatusCode)
+	if e.Problem != nil && (e.Problem.Title != "" || e.Problem.Detail != "") {
+		if e.Problem.Title != "" {
+			msg += ": " + e.Problem.Title
+		}
+		if e.Problem.Detail != "" {
+			msg += ": " + e.Problem.Detail
+		}
+		return msg
+	}
+	if e.snippet != "" {
+		msg += ": " + e.snippet
+	}
+	return msg
 }
 
 func (e *StatusError) Unwrap() error {
 	return ErrStatus
 }
+
+// As lets errors.As extract Result when it implements error.
+func (e *StatusError) As(target any) bool {
+	if err, ok := e.Result.(error); ok {
+		return errors.As(err, target)
+	}
+	return false
+}
+
+// bodySnippet returns body collapsed to a single line and truncated to max bytes.
+// Non-UTF-8 bodies yield an empty snippet.
+func bodySnippet(body []byte, max int) string {
+	if !utf8.Valid(body) {
+		return ""
+	}
+	s := strings.Join(strings.Fields(string(body)), " ")
+	if len(s) <= max {
+		return s
+	}
+	cut := max
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + "..."
+}
+
+// ProblemDetails is an RFC 9457 (formerly RFC 7807) problem details object.
+// Members not defined by the RFC are collected in Extensions.
+type ProblemDetails struct {
+	Type       string
+	Title      string
+	Status     int
+	Detail     string
+	Instance   string
+	Extensions map[string]any
+}
+
+// UnmarshalJSON decodes a problem details object. Members with unexpected types are ignored, as the RFC requires.
+func (p *ProblemDetails) UnmarshalJSON(b []byte) error {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(b, &members); err != nil {
+		return err
+	}
+	*p = ProblemDetails{}
+	for k, raw := range members {
+		switch k {
+		case "type":
+			_ = json.Unmarshal(raw, &p.Type)
+		case "title":
+			_ = json.Unmarshal(raw, &p.Title)
+		case "status":
+			_ = json.Unmarshal(raw, &p.Status)
+		case "detail":
+			_ = json.Unmarshal(raw, &p.Detail)
+		case "instance":
+			_ = json.Unmarshal(raw, &p.Instance)
+		default:
+			var v any
+			if err := json.Unmarshal(raw, &v); err != nil {
+				return err
+			}
+			if p.Extensions == nil {
+				p.Extensions = make(map[string]any)
+			}
+			p.Extensions[k] = v
+		}
+	}
+	return nil
+}
+
+// MarshalJSON encodes the problem details with extensions as top-level members.
+func (p ProblemDetails) MarshalJSON() ([]byte, error) {
+	m := make(map[string]any, len(p.Extensions)+5)
+	for k, v := range p.Extensions {
+		m[k] = v
+	}
+	for k, v := range map[string]string{"type": p.Type, "title": p.Title, "detail": p.Detail, "instance": p.Instance} {
+		if v != "" {
+			m[k] = v
+		}
+	}
+	if p.Status != 0 {
+		m["status"] = p.Status
+	}
+	return json.Marshal(m)
+}
+
+func isProblemJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && strings.EqualFold(mediaType, "application/problem+json")
+}
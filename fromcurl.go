@@ -0,0 +1,574 @@
+package requests
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// curlFlags maps curl flags to their canonical long name and whether they take a value.
+var curlFlags = map[string]struct {
+	name     string
+	hasValue bool
+}{
+	"-X": {"--request", true}, "--request": {"--request", true},
+	"-H": {"--header", true}, "--header": {"--header", true},
+	"-d": {"--data", true}, "--data": {"--data", true}, "--data-ascii": {"--data", true},
+	"--data-binary":    {"--data-binary", true},
+	"--data-raw":       {"--data-raw", true},
+	"--data-urlencode": {"--data-urlencode", true},
+	"-F":               {"--form", true}, "--form": {"--form", true},
+	"--form-string": {"--form-string", true},
+	"-u":            {"--user", true}, "--user": {"--user", true},
+	"-b": {"--cookie", true}, "--cookie": {"--cookie", true},
+	"-x": {"--proxy", true}, "--proxy": {"--proxy", true},
+	"-A": {"--user-agent", true}, "--user-agent": {"--user-agent", true},
+	"-e": {"--referer", true}, "--referer": {"--referer", true},
+	"-m": {"--max-time", true}, "--max-time": {"--max-time", true},
+	"--max-redirs":  {"--max-redirs", true},
+	"--url":         {"--url", true},
+	"--unix-socket": {"--unix-socket", true},
+	"--resolve":     {"--resolve", true},
+	"-U":            {"--proxy-user", true}, "--proxy-user": {"--proxy-user", true},
+	"--proxy-header": {"--proxy-header", true},
+	"-L":             {"--location", false}, "--location": {"--location", false},
+	"-k": {"--insecure", false}, "--insecure": {"--insecure", false},
+	"-G": {"--get", false}, "--get": {"--get", false},
+	"-I": {"--head", false}, "--head": {"--head", false},
+	"--compressed": {"--compressed", false},
+	// Flags that only affect curl's own output are accepted and ignored.
+	"-s": {"", false}, "--silent": {"", false},
+	"-S": {"", false}, "--show-error": {"", false},
+	"-v": {"", false}, "--verbose": {"", false},
+	"-i": {"", false}, "--include": {"", false},
+	"-g": {"", false}, "--globoff": {"", false},
+	"--http1.1": {"--http1.1", false}, "--http2": {"", false},
+	"--http2-prior-knowledge": {"--http2-prior-knowledge", false},
+}
+
+// FromCurl parses a curl command line into a method, URL and options that reproduce it.
+//
+// Supported flags: -X, -H, -d/--data, --data-binary, --data-raw, --data-urlencode, -F/--form,
+// --form-string, -u, -b, -x, -U, --proxy-header, -L, --max-redirs, -k, -G, -I, -A, -e, -m,
+// --compressed, --http1.1, --http2-prior-knowledge, --resolve, --unix-socket and --url.
+// Without -L redirects are not followed, as in curl. Output-only flags such as -s and -v are ignored.
+// Errors wrap ErrRequest.
+func FromCurl(cmd string) (method, rawURL string, opts []Option, err error) {
+	args, err := splitShell(cmd)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("%w: %v", ErrRequest, err)
+	}
+	if len(args) == 0 || args[0] != "curl" {
+		return "", "", nil, fmt.Errorf("%w: not a curl command", ErrRequest)
+	}
+
+	p := curlParser{}
+	if err := p.parse(args[1:]); err != nil {
+		return "", "", nil, fmt.Errorf("%w: %v", ErrRequest, err)
+	}
+	method, rawURL, opts, err = p.build()
+	if err != nil {
+		return "", "", nil, fmt.Errorf("%w: %v", ErrRequest, err)
+	}
+	return method, rawURL, opts, nil
+}
+
+type curlParser struct {
+	method       string
+	url          string
+	headers      [][2]string
+	data         []string
+	hasData      bool
+	form         *multipart.Writer
+	formBuf      bytes.Buffer
+	user         *string
+	cookies      []*http.Cookie
+	proxy        string
+	proxyUser    *string
+	proxyHeaders [][2]string
+	unixSocket   string
+	resolve      [][2]string
+	location     bool
+	maxRedirs    int
+	insecure     bool
+	get          bool
+	head         bool
+	compressed   bool
+	protocol     Option
+	timeout      time.Duration
+}
+
+func (p *curlParser) parse(args []string) error {
+	p.maxRedirs = -1
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			if p.url != "" {
+				return fmt.Errorf("unexpected argument %q", arg)
+			}
+			p.url = arg
+			continue
+		}
+
+		flag, value, inline := arg, "", false
+		if !strings.HasPrefix(arg, "--") && len(arg) > 2 {
+			// Short flags may be grouped (-sSL) and the last one may carry its value (-XPOST).
+			for j := 1; j < len(arg); j++ {
+				flag = "-" + arg[j:j+1]
+				if spec, ok := curlFlags[flag]; ok && spec.hasValue {
+					value, inline = arg[j+1:], j+1 < len(arg)
+					break
+				}
+				if j == len(arg)-1 {
+					break
+				}
+				spec, ok := curlFlags[flag]
+				if !ok {
+					return fmt.Errorf("unsupported flag %s", flag)
+				}
+				if err := p.apply(spec.name, ""); err != nil {
+					return err
+				}
+			}
+		}
+		spec, ok := curlFlags[flag]
+		if !ok {
+			return fmt.Errorf("unsupported flag %s", flag)
+		}
+		if spec.hasValue && !inline {
+			if i+1 >= len(args) {
+				return fmt.Errorf("flag %s requires a value", flag)
+			}
+			i++
+			value = args[i]
+		}
+		if err := p.apply(spec.name, value); err != nil {
+			return fmt.Errorf("%s: %w", flag, err)
+		}
+	}
+	if p.url == "" {
+		return fmt.Errorf("missing URL")
+	}
+	return nil
+}
+
+func (p *curlParser) apply(name, value string) error {
+	switch name {
+	case "--request":
+		p.method = strings.ToUpper(value)
+	case "--header":
+		k, v, ok := strings.Cut(value, ":")
+		if !ok {
+			k, v = strings.TrimSuffix(value, ";"), ""
+		}
+		p.headers = append(p.headers, [2]string{strings.TrimSpace(k), strings.TrimSpace(v)})
+	case "--data", "--data-binary":
+		if file, ok := strings.CutPrefix(value, "@"); ok {
+			b, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			value = string(b)
+			if name == "--data" {
+				value = strings.NewReplacer("\r", "", "\n", "").Replace(value)
+			}
+		}
+		p.addData(value)
+	case "--data-raw":
+		p.addData(value)
+	case "--data-urlencode":
+		v, err := curlURLEncode(value)
+		if err != nil {
+			return err
+		}
+		p.addData(v)
+	case "--form", "--form-string":
+		return p.addForm(value, name == "--form-string")
+	case "--user":
+		p.user = &value
+	case "--cookie":
+		if !strings.Contains(value, "=") {
+			return fmt.Errorf("cookie files are not supported")
+		}
+		cookies, err := http.ParseCookie(value)
+		if err != nil {
+			return err
+		}
+		p.cookies = append(p.cookies, cookies...)
+	case "--proxy":
+		p.proxy = value
+	case "--proxy-user":
+		p.proxyUser = &value
+	case "--proxy-header":
+		k, v, ok := strings.Cut(value, ":")
+		if !ok {
+			return fmt.Errorf("invalid header %q", value)
+		}
+		p.proxyHeaders = append(p.proxyHeaders, [2]string{strings.TrimSpace(k), strings.TrimSpace(v)})
+	case "--user-agent":
+		p.headers = append(p.headers, [2]string{"User-Agent", value})
+	case "--referer":
+		p.headers = append(p.headers, [2]string{"Referer", value})
+	case "--max-time":
+		secs, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		p.timeout = time.Duration(secs * float64(time.Second))
+	case "--max-redirs":
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		p.maxRedirs = n
+	case "--url":
+		p.url = value
+	case "--unix-socket":
+		p.unixSocket = value
+	case "--resolve":
+		host, rest, ok1 := strings.Cut(strings.TrimPrefix(value, "+"), ":")
+		port, addr, ok2 := strings.Cut(rest, ":")
+		if !ok1 || !ok2 {
+			return fmt.Errorf("invalid value %q", value)
+		}
+		addr, _, _ = strings.Cut(addr, ",")
+		p.resolve = append(p.resolve, [2]string{net.JoinHostPort(host, port), strings.Trim(addr, "[]")})
+	case "--location":
+		p.location = true
+	case "--insecure":
+		p.insecure = true
+	case "--get":
+		p.get = true
+	case "--head":
+		p.head = true
+	case "--compressed":
+		p.compressed = true
+	case "--http1.1":
+		p.protocol = WithHTTP1Only()
+	case "--http2-prior-knowledge":
+		p.protocol = WithH2C()
+	}
+	return nil
+}
+
+func (p *curlParser) addData(v string) {
+	p.hasData = true
+	p.data = append(p.data, v)
+}
+
+// addForm adds a multipart field. "name=@file" uploads a file, "name=<file" reads the value
+// from a file and ";type=" sets the part content type.
+func (p *curlParser) addForm(value string, literal bool) error {
+	if p.form == nil {
+		p.form = multipart.NewWriter(&p.formBuf)
+	}
+	name, v, ok := strings.Cut(value, "=")
+	if !ok {
+		return fmt.Errorf("invalid form field %q", value)
+	}
+	if literal {
+		return p.form.WriteField(name, v)
+	}
+	var contentType string
+	if i := strings.Index(v, ";type="); i >= 0 {
+		v, contentType = v[:i], v[i+len(";type="):]
+	}
+	switch {
+	case strings.HasPrefix(v, "@"):
+		file := v[1:]
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		h := make(map[string][]string)
+		h["Content-Disposition"] = []string{fmt.Sprintf(`form-data; name=%q; filename=%q`, name, filepath.Base(file))}
+		h["Content-Type"] = []string{contentType}
+		w, err := p.form.CreatePart(h)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	case strings.HasPrefix(v, "<"):
+		b, err := os.ReadFile(v[1:])
+		if err != nil {
+			return err
+		}
+		v = string(b)
+	}
+	if contentType == "" {
+		return p.form.WriteField(name, v)
+	}
+	h := make(map[string][]string)
+	h["Content-Disposition"] = []string{fmt.Sprintf(`form-data; name=%q`, name)}
+	h["Content-Type"] = []string{contentType}
+	w, err := p.form.CreatePart(h)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write([]byte(v))
+	return err
+}
+
+func (p *curlParser) build() (string, string, []Option, error) {
+	rawURL := p.url
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL
+	}
+	var opts []Option
+	// The first -H for a name replaces any default; repeated ones add values as curl sends them all.
+	seen := make(map[string]bool)
+	for _, h := range p.headers {
+		name := http.CanonicalHeaderKey(h[0])
+		if seen[name] {
+			opts = append(opts, withAddedHeader(h[0], h[1]))
+		} else {
+			opts = append(opts, WithHeader(h[0], h[1]))
+		}
+		seen[name] = true
+	}
+
+	method := http.MethodGet
+	body := strings.Join(p.data, "&")
+	switch {
+	case p.form != nil:
+		if err := p.form.Close(); err != nil {
+			return "", "", nil, err
+		}
+		method = http.MethodPost
+		opts = append(opts, withBodyBytes(p.formBuf.Bytes()),
+			WithHeader("Content-Type", p.form.FormDataContentType()))
+	case p.hasData && p.get:
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return "", "", nil, err
+		}
+		if u.RawQuery != "" {
+			u.RawQuery += "&"
+		}
+		u.RawQuery += body
+		rawURL = u.String()
+	case p.hasData:
+		method = http.MethodPost
+		opts = append(opts, withBodyBytes([]byte(body)),
+			withDefaultHeader("Content-Type", "application/x-www-form-urlencoded"))
+	}
+	if p.head {
+		method = http.MethodHead
+	}
+	if p.method != "" {
+		method = p.method
+	}
+
+	// curl only sends -u credentials when no Authorization header was given with -H.
+	if p.user != nil && !seen["Authorization"] {
+		opts = append(opts, WithHeader("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(*p.user))))
+	}
+	if len(p.cookies) > 0 {
+		opts = append(opts, WithCookies(p.cookies...))
+	}
+	if p.proxy != "" {
+		proxy := p.proxy
+		if !strings.Contains(proxy, "://") {
+			proxy = "http://" + proxy
+		}
+		if p.proxyUser != nil {
+			u, err := url.Parse(proxy)
+			if err != nil {
+				return "", "", nil, err
+			}
+			user, pass, _ := strings.Cut(*p.proxyUser, ":")
+			u.User = url.UserPassword(user, pass)
+			proxy = u.String()
+		}
+		opts = append(opts, WithProxy(proxy))
+	}
+	for _, h := range p.proxyHeaders {
+		opts = append(opts, WithProxyConnectHeader(h[0], h[1]))
+	}
+	if p.unixSocket != "" {
+		opts = append(opts, WithUnixSocket(p.unixSocket))
+	}
+	for _, r := range p.resolve {
+		opts = append(opts, WithResolve(r[0], r[1]))
+	}
+	switch {
+	case !p.location:
+		opts = append(opts, WithRedirect(0))
+	case p.maxRedirs >= 0:
+		opts = append(opts, WithRedirect(p.maxRedirs))
+	}
+	if p.insecure {
+		opts = append(opts, WithInsecureSkipVerify())
+	}
+	if p.compressed {
+		opts = append(opts, WithDecompression())
+	}
+	if p.timeout > 0 {
+		opts = append(opts, WithTimeout(p.timeout))
+	}
+	if p.protocol != nil {
+		opts = append(opts, p.protocol)
+	}
+	return method, rawURL, opts, nil
+}
+
+// withBodyBytes sets a body read from b, creating a new reader every time it is applied
+// so the options returned by FromCurl can be reused.
+func withBodyBytes(b []byte) Option {
+	return func(r *Request) {
+		r.body = bytes.NewReader(b)
+	}
+}
+
+// curlURLEncode implements the --data-urlencode forms: "content", "=content",
+// "name=content", "@file" and "name@file".
+func curlURLEncode(v string) (string, error) {
+	escape := func(s string) string {
+		return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+	}
+	if i := strings.IndexAny(v, "=@"); i >= 0 {
+		name, content := v[:i], v[i+1:]
+		if v[i] == '@' {
+			b, err := os.ReadFile(content)
+			if err != nil {
+				return "", err
+			}
+			content = string(b)
+		}
+		if name == "" {
+			return escape(content), nil
+		}
+		return name + "=" + escape(content), nil
+	}
+	return escape(v), nil
+}
+
+// splitShell splits a POSIX shell command line into words. It supports single quotes,
+// double quotes, ANSI-C $'...' quotes, backslash escapes and line continuations.
+func splitShell(s string) ([]string, error) {
+	var (
+		words   []string
+		cur     strings.Builder
+		inWord  bool
+		r       = []rune(s)
+		hexRune = func(digits string) (rune, bool) {
+			n, err := strconv.ParseUint(digits, 16, 32)
+			return rune(n), err == nil
+		}
+	)
+	flush := func() {
+		if inWord {
+			words = append(words, cur.String())
+			cur.Reset()
+			inWord = false
+		}
+	}
+	for i := 0; i < len(r); i++ {
+		c := r[i]
+		switch {
+		case c == '\\':
+			if i+1 >= len(r) {
+				return nil, fmt.Errorf("trailing backslash")
+			}
+			i++
+			if r[i] == '\n' {
+				continue
+			}
+			if r[i] == '\r' && i+1 < len(r) && r[i+1] == '\n' {
+				i++
+				continue
+			}
+			cur.WriteRune(r[i])
+			inWord = true
+		case c == '\'':
+			end := indexRune(r, i+1, '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated single quote")
+			}
+			cur.WriteString(string(r[i+1 : end]))
+			i = end
+			inWord = true
+		case c == '"':
+			i++
+			for ; i < len(r) && r[i] != '"'; i++ {
+				if r[i] == '\\' && i+1 < len(r) && strings.ContainsRune("\"\\$`\n", r[i+1]) {
+					i++
+					if r[i] == '\n' {
+						continue
+					}
+				}
+				cur.WriteRune(r[i])
+			}
+			if i >= len(r) {
+				return nil, fmt.Errorf("unterminated double quote")
+			}
+			inWord = true
+		case c == '$' && i+1 < len(r) && r[i+1] == '\'':
+			i += 2
+			for ; i < len(r) && r[i] != '\''; i++ {
+				if r[i] != '\\' || i+1 >= len(r) {
+					cur.WriteRune(r[i])
+					continue
+				}
+				i++
+				switch e := r[i]; e {
+				case 'n':
+					cur.WriteByte('\n')
+				case 't':
+					cur.WriteByte('\t')
+				case 'r':
+					cur.WriteByte('\r')
+				case 'x', 'u', 'U':
+					size := map[rune]int{'x': 2, 'u': 4, 'U': 8}[e]
+					end := min(i+1+size, len(r))
+					v, ok := hexRune(string(r[i+1 : end]))
+					if !ok {
+						return nil, fmt.Errorf("invalid escape \\%c", e)
+					}
+					if e == 'x' {
+						cur.WriteByte(byte(v))
+					} else if utf8.ValidRune(v) {
+						cur.WriteRune(v)
+					}
+					i = end - 1
+				default:
+					cur.WriteRune(e)
+				}
+			}
+			if i >= len(r) {
+				return nil, fmt.Errorf("unterminated $' quote")
+			}
+			inWord = true
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			flush()
+		default:
+			cur.WriteRune(c)
+			inWord = true
+		}
+	}
+	flush()
+	return words, nil
+}
+
+func indexRune(r []rune, from int, c rune) int {
+	for i := from; i < len(r); i++ {
+		if r[i] == c {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,541 @@
+package requests
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const defaultHARBodyLimit = 1 << 20
+
+// HAROption configures a Recorder.
+type HAROption func(*Recorder)
+
+// HARBodyLimit sets how many bytes of each request and response body are kept.
+// Zero disables body capture. The default is 1 MiB.
+func HARBodyLimit(max int) HAROption {
+	return func(rec *Recorder) {
+		rec.maxBody = max
+	}
+}
+
+// HARRedactHeaders adds header names whose values are replaced with REDACTED.
+func HARRedactHeaders(names ...string) HAROption {
+	return func(rec *Recorder) {
+		rec.redact = append(rec.redact, names...)
+	}
+}
+
+// Recorder captures traffic in HTTP Archive (HAR) 1.2 format.
+// Install it with WithMiddleware(rec.Middleware()), typically on a Session,
+// and save the archive with WriteHAR. Each redirect hop becomes its own entry.
+// Sensitive headers, cookies and query parameters are redacted as in WithLogger.
+type Recorder struct {
+	maxBody int
+	redact  []string
+
+	mu      sync.Mutex
+	entries []*harEntry
+}
+
+// NewRecorder creates an empty Recorder.
+func NewRecorder(opts ...HAROption) *Recorder {
+	rec := &Recorder{maxBody: defaultHARBodyLimit}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(rec)
+		}
+	}
+	return rec
+}
+
+// Middleware returns the middleware that records requests sent through it.
+func (rec *Recorder) Middleware() Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return rec.roundTrip(next, req)
+		})
+	}
+}
+
+// WriteHAR writes the recorded entries as a HAR document.
+// Response bodies appear once they have been fully read or closed.
+func (rec *Recorder) WriteHAR(w io.Writer) error {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	doc := harDoc{Log: harLog{
+		Version: "1.2",
+		Creator: harCreator{Name: "go-requests", Version: moduleVersion()},
+		Entries: rec.entries,
+	}}
+	if doc.Log.Entries == nil {
+		doc.Log.Entries = []*harEntry{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+// Reset discards the recorded entries.
+func (rec *Recorder) Reset() {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.entries = nil
+}
+
+func (rec *Recorder) roundTrip(next http.RoundTripper, req *http.Request) (*http.Response, error) {
+	ht := &harTrace{}
+	ctx := httptrace.WithClientTrace(req.Context(), ht.clientTrace())
+	req = req.WithContext(ctx)
+
+	// Bodies that can be replayed are captured from a copy so the transport keeps sole use of req.Body.
+	var reqBody *capture
+	if req.Body != nil && req.Body != http.NoBody && rec.maxBody > 0 {
+		if req.GetBody != nil {
+			if rc, err := req.GetBody(); err == nil {
+				reqBody = &capture{ReadCloser: rc, max: rec.maxBody}
+				_, _ = io.Copy(io.Discard, reqBody)
+				_ = rc.Close()
+			}
+		} else {
+			reqBody = &capture{ReadCloser: req.Body, max: rec.maxBody}
+			req.Body = reqBody
+		}
+	}
+
+	started := time.Now()
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		rec.add(rec.entry(req, nil, reqBody, ht.hop(0), started))
+		return resp, err
+	}
+
+	// Walk the redirect chain back to the first hop.
+	var hops []*http.Response
+	for r := resp; r != nil; r = r.Request.Response {
+		hops = append([]*http.Response{r}, hops...)
+		if r.Request == nil {
+			break
+		}
+	}
+	var last *harEntry
+	for i, hop := range hops {
+		body := reqBody
+		if i > 0 {
+			body = nil
+		}
+		e := rec.entry(hop.Request, hop, body, ht.hop(i), started)
+		rec.add(e)
+		last = e
+	}
+
+	if rec.maxBody > 0 && resp.Body != nil {
+		firstByte := ht.hop(len(hops) - 1).firstByte
+		resp.Body = &capture{ReadCloser: resp.Body, max: rec.maxBody, done: func(c *capture) {
+			rec.mu.Lock()
+			defer rec.mu.Unlock()
+			last.Response.Content.setBody(c.buf.Bytes(), c.n, c.truncated)
+			last.Response.BodySize = c.n
+			if !firstByte.IsZero() {
+				last.Timings.Receive = ms(time.Since(firstByte))
+				last.Time = last.Timings.total()
+			}
+		}}
+	}
+	return resp, nil
+}
+
+func (rec *Recorder) add(e *harEntry) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.entries = append(rec.entries, e)
+}
+
+func (rec *Recorder) entry(req *http.Request, resp *http.Response, reqBody *capture, t hopTimes, started time.Time) *harEntry {
+	if !t.start.IsZero() {
+		started = t.start
+	}
+	e := &harEntry{
+		StartedDateTime: started.UTC().Format(time.RFC3339Nano),
+		Request:         rec.harRequest(req, reqBody),
+		Cache:           struct{}{},
+		Timings:         t.harTimings(),
+		ServerIPAddress: t.remoteIP(),
+	}
+	if resp != nil {
+		e.Response = rec.harResponse(resp)
+	} else {
+		e.Response = harResponse{Cookies: []harCookie{}, Headers: []harNV{}, HeadersSize: -1, BodySize: -1}
+	}
+	e.Time = e.Timings.total()
+	return e
+}
+
+func (rec *Recorder) harRequest(req *http.Request, body *capture) harRequest {
+	r := harRequest{
+		Method:      req.Method,
+		URL:         redactURL(req.URL),
+		HTTPVersion: req.Proto,
+		Cookies:     []harCookie{},
+		Headers:     rec.headers(req.Header),
+		QueryString: queryPairs(req.URL.RawQuery),
+		HeadersSize: -1,
+		BodySize:    req.ContentLength,
+	}
+	if r.HTTPVersion == "" {
+		r.HTTPVersion = "HTTP/1.1"
+	}
+	if req.Host != "" && req.Host != req.URL.Host {
+		r.Headers = append([]harNV{{Name: "Host", Value: req.Host}}, r.Headers...)
+	}
+	for _, c := range req.Cookies() {
+		r.Cookies = append(r.Cookies, harCookie{Name: c.Name, Value: redacted})
+	}
+	if body != nil {
+		r.PostData = &harPostData{MimeType: req.Header.Get("Content-Type"), Text: body.buf.String()}
+		if body.truncated {
+			r.PostData.Comment = "truncated"
+		}
+		r.BodySize = body.n
+	}
+	return r
+}
+
+func (rec *Recorder) harResponse(resp *http.Response) harResponse {
+	r := harResponse{
+		Status:      resp.StatusCode,
+		StatusText:  http.StatusText(resp.StatusCode),
+		HTTPVersion: resp.Proto,
+		Cookies:     []harCookie{},
+		Headers:     rec.headers(resp.Header),
+		Content:     harContent{Size: 0, MimeType: resp.Header.Get("Content-Type")},
+		RedirectURL: resp.Header.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    -1,
+	}
+	for _, c := range resp.Cookies() {
+		hc := harCookie{Name: c.Name, Value: redacted, Path: c.Path, Domain: c.Domain, HTTPOnly: c.HttpOnly, Secure: c.Secure}
+		if !c.Expires.IsZero() {
+			hc.Expires = c.Expires.UTC().Format(time.RFC3339)
+		}
+		r.Cookies = append(r.Cookies, hc)
+	}
+	return r
+}
+
+func (rec *Recorder) headers(h http.Header) []harNV {
+	out := []harNV{}
+	for _, k := range sortedKeys(h, strings.Compare) {
+		for _, v := range h[k] {
+			if isSensitiveName(k, rec.redact) {
+				v = redacted
+			}
+			out = append(out, harNV{Name: k, Value: v})
+		}
+	}
+	return out
+}
+
+func queryPairs(raw string) []harNV {
+	out := []harNV{}
+	for pair := range strings.SplitSeq(raw, "&") {
+		if pair == "" {
+			continue
+		}
+		k, v, _ := strings.Cut(pair, "=")
+		if uk, err := url.QueryUnescape(k); err == nil {
+			k = uk
+		}
+		if uv, err := url.QueryUnescape(v); err == nil {
+			v = uv
+		}
+		if isSensitiveName(k, nil) {
+			v = redacted
+		}
+		out = append(out, harNV{Name: k, Value: v})
+	}
+	return out
+}
+
+func moduleVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if ok {
+		for _, m := range info.Deps {
+			if m.Path == "github.com/CareyWang/go-requests" {
+				return m.Version
+			}
+		}
+	}
+	return "devel"
+}
+
+// capture keeps up to max bytes read through it and calls done once on EOF or Close.
+type capture struct {
+	io.ReadCloser
+	max       int
+	buf       bytes.Buffer
+	n         int64
+	truncated bool
+	once      sync.Once
+	done      func(*capture)
+}
+
+func (c *capture) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	if n > 0 {
+		c.n += int64(n)
+		keep := min(n, c.max-c.buf.Len())
+		c.buf.Write(p[:keep])
+		if keep < n {
+			c.truncated = true
+		}
+	}
+	if err == io.EOF {
+		c.finish()
+	}
+	return n, err
+}
+
+// String returns the captured bytes, followed by "..." when the body was longer.
+func (c *capture) String() string {
+	if c.truncated {
+		return c.buf.String() + "..."
+	}
+	return c.buf.String()
+}
+
+func (c *capture) Close() error {
+	c.finish()
+	return c.ReadCloser.Close()
+}
+
+func (c *capture) finish() {
+	if c.done != nil {
+		c.once.Do(func() { c.done(c) })
+	}
+}
+
+// harTrace records connection timings for every hop of a request.
+type harTrace struct {
+	mu   sync.Mutex
+	hops []hopTimes
+}
+
+type hopTimes struct {
+	start      time.Time
+	dnsStart   time.Time
+	dnsDone    time.Time
+	connStart  time.Time
+	connDone   time.Time
+	tlsStart   time.Time
+	tlsDone    time.Time
+	gotConn    time.Time
+	wrote      time.Time
+	firstByte  time.Time
+	remoteAddr string
+}
+
+func (t *harTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GetConn: func(string) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.hops = append(t.hops, hopTimes{start: time.Now()})
+		},
+		DNSStart:          func(httptrace.DNSStartInfo) { t.set(func(h *hopTimes) { h.dnsStart = time.Now() }) },
+		DNSDone:           func(httptrace.DNSDoneInfo) { t.set(func(h *hopTimes) { h.dnsDone = time.Now() }) },
+		ConnectStart:      func(string, string) { t.set(func(h *hopTimes) { h.connStart = time.Now() }) },
+		ConnectDone:       func(string, string, error) { t.set(func(h *hopTimes) { h.connDone = time.Now() }) },
+		TLSHandshakeStart: func() { t.set(func(h *hopTimes) { h.tlsStart = time.Now() }) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { t.set(func(h *hopTimes) { h.tlsDone = time.Now() }) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.set(func(h *hopTimes) {
+				h.gotConn = time.Now()
+				if info.Conn != nil {
+					h.remoteAddr = info.Conn.RemoteAddr().String()
+				}
+			})
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { t.set(func(h *hopTimes) { h.wrote = time.Now() }) },
+		GotFirstResponseByte: func() { t.set(func(h *hopTimes) { h.firstByte = time.Now() }) },
+	}
+}
+
+func (t *harTrace) set(fn func(*hopTimes)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.hops) > 0 {
+		fn(&t.hops[len(t.hops)-1])
+	}
+}
+
+func (t *harTrace) hop(i int) hopTimes {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if i < 0 || i >= len(t.hops) {
+		return hopTimes{}
+	}
+	return t.hops[i]
+}
+
+func (h hopTimes) harTimings() harTimings {
+	opt := func(start, end time.Time) float64 {
+		if start.IsZero() || end.IsZero() {
+			return -1
+		}
+		return ms(span(start, end))
+	}
+	t := harTimings{
+		Blocked: -1,
+		DNS:     opt(h.dnsStart, h.dnsDone),
+		Connect: opt(h.connStart, h.connDone),
+		SSL:     opt(h.tlsStart, h.tlsDone),
+		Send:    max(opt(h.gotConn, h.wrote), 0),
+		Wait:    max(opt(h.wrote, h.firstByte), 0),
+	}
+	// HAR connect time includes the TLS handshake.
+	if t.SSL > 0 && t.Connect >= 0 {
+		t.Connect += t.SSL
+	}
+	if !h.start.IsZero() && !h.gotConn.IsZero() {
+		t.Blocked = max(ms(span(h.start, h.gotConn))-max(t.DNS, 0)-max(t.Connect, 0), 0)
+	}
+	return t
+}
+
+func (h hopTimes) remoteIP() string {
+	if h.remoteAddr == "" {
+		return ""
+	}
+	host := h.remoteAddr
+	if i := strings.LastIndex(host, ":"); i >= 0 {
+		host = host[:i]
+	}
+	return strings.Trim(host, "[]")
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+type harDoc struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string      `json:"version"`
+	Creator harCreator  `json:"creator"`
+	Entries []*harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	ServerIPAddress string      `json:"serverIPAddress,omitempty"`
+}
+
+type harRequest struct {
+	Method      string       `json:"method"`
+	URL         string       `json:"url"`
+	HTTPVersion string       `json:"httpVersion"`
+	Cookies     []harCookie  `json:"cookies"`
+	Headers     []harNV      `json:"headers"`
+	QueryString []harNV      `json:"queryString"`
+	PostData    *harPostData `json:"postData,omitempty"`
+	HeadersSize int64        `json:"headersSize"`
+	BodySize    int64        `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int         `json:"status"`
+	StatusText  string      `json:"statusText"`
+	HTTPVersion string      `json:"httpVersion"`
+	Cookies     []harCookie `json:"cookies"`
+	Headers     []harNV     `json:"headers"`
+	Content     harContent  `json:"content"`
+	RedirectURL string      `json:"redirectURL"`
+	HeadersSize int64       `json:"headersSize"`
+	BodySize    int64       `json:"bodySize"`
+}
+
+type harNV struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harCookie struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Path     string `json:"path,omitempty"`
+	Domain   string `json:"domain,omitempty"`
+	Expires  string `json:"expires,omitempty"`
+	HTTPOnly bool   `json:"httpOnly,omitempty"`
+	Secure   bool   `json:"secure,omitempty"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+type harContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+func (c *harContent) setBody(b []byte, size int64, truncated bool) {
+	c.Size = size
+	if utf8.Valid(b) {
+		c.Text = string(b)
+	} else {
+		c.Text = base64.StdEncoding.EncodeToString(b)
+		c.Encoding = "base64"
+	}
+	if truncated {
+		c.Comment = "truncated"
+	}
+}
+
+type harTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+// total is the entry time: the sum of all known phases, with SSL counted inside connect.
+func (t harTimings) total() float64 {
+	total := t.Send + t.Wait + t.Receive
+	for _, v := range []float64{t.Blocked, t.DNS, t.Connect} {
+		if v > 0 {
+			total += v
+		}
+	}
+	return total
+}
@@ -1,14 +1,16 @@
 package requests
 
 import (
-	"compress/gzip"
 	"context"
 	"errors"
 	"fmt"
-	"io"
 	"net"
 	"net/http"
-	"strings"
+	"net/http/httptrace"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/proxy"
 )
 
 // Get sends a GET request.
@@ -46,65 +48,118 @@ func Options(ctx context.Context, url string, opts ...Option) (*Response, error)
 	return do(ctx, http.MethodOptions, url, opts...)
 }
 
+// Do sends a request with the given method, for example one returned by FromCurl.
+func Do(ctx context.Context, method, url string, opts ...Option) (*Response, error) {
+	return do(ctx, method, url, opts...)
+}
+
 func do(ctx context.Context, method, rawURL string, opts ...Option) (*Response, error) {
-	req := newRequest(method, rawURL, opts...)
+	return send(ctx, newRequest(method, rawURL, opts...))
+}
+
+func send(ctx context.Context, req *Request) (*Response, error) {
 	if req.err != nil {
 		return nil, fmt.Errorf("%w: %v", ErrRequest, req.err)
 	}
-	u, err := req.buildURL()
+	var tr *tracer
+	if req.trace || req.metrics != nil {
+		tr = newTracer()
+		ctx = httptrace.WithClientTrace(ctx, tr.clientTrace())
+	}
+	httpReq, err := req.newHTTPRequest(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %v", ErrRequest, err)
 	}
-	httpReq, err := http.NewRequestWithContext(ctx, method, u.String(), req.body)
+	method, host := httpReq.Method, httpReq.URL.Host
+
+	client, err := buildClient(req)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %v", ErrRequest, err)
 	}
-	if req.headers != nil {
-		httpReq.Header = req.headers
+	if req.log != nil {
+		req.log.logRequest(ctx, httpReq)
 	}
-	for _, c := range req.cookies {
-		httpReq.AddCookie(c)
+	if req.metrics != nil {
+		req.metrics.RequestStarted(method, host)
+	}
+	rt := RoundTripperFunc(client.Do)
+	if len(req.decompress) > 0 {
+		rt = decoding(rt, req.decompress)
+	}
+	start := time.Now()
+	resp, err := chain(rt, req.middleware).RoundTrip(httpReq)
+	elapsed := time.Since(start)
+	if req.metrics != nil {
+		m := RequestMetrics{Method: method, Host: host, Err: err, Duration: elapsed, ConnReused: tr.timings().Reused}
+		if resp != nil && err == nil {
+			m.StatusCode = resp.StatusCode
+		}
+		req.metrics.RequestFinished(m)
 	}
-
-	client := buildClient(req)
-	resp, err := client.Do(httpReq)
 	if err != nil {
-		return nil, classifyErr(err)
+		err = classifyErr(err)
+		if req.log != nil {
+			req.log.logError(ctx, httpReq, err, elapsed)
+		}
+		return nil, err
 	}
 
-	if req.decompressGzip && !resp.Uncompressed && isGzipEncoded(resp.Header) {
-		gz, err := gzip.NewReader(resp.Body)
-		if err != nil {
-			_ = resp.Body.Close()
-			return nil, fmt.Errorf("%w: %v", ErrResponse, err)
+	// Responses produced by middlewares, such as mocks and replayed cassettes, are decoded here.
+	if len(req.decompress) > 0 && !resp.Uncompressed {
+		if err := decodeResponse(resp, req.decompress); err != nil {
+			return nil, err
 		}
-		resp.Body = gzipReadCloser{Reader: gz, closer: resp.Body}
-		resp.Header.Del("Content-Encoding")
-		resp.Uncompressed = true
 	}
 
 	wrapped := newResponse(resp)
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return wrapped, &StatusError{StatusCode: resp.StatusCode, Response: wrapped}
+	wrapped.req = req
+	wrapped.sent = httpReq
+	wrapped.Elapsed = elapsed
+	for prev := resp.Request; prev != nil && prev.Response != nil; prev = prev.Response.Request {
+		wrapped.History = append([]*Response{newResponse(prev.Response)}, wrapped.History...)
+	}
+	if req.trace {
+		resp.Body = tracedBody{ReadCloser: resp.Body, t: tr}
+		wrapped.trace = tr
+	}
+	ok := req.isOK(resp.StatusCode)
+	if req.log != nil {
+		req.log.logResponse(ctx, httpReq, wrapped, ok, elapsed)
+	}
+	if !ok {
+		return wrapped, newStatusError(req, wrapped)
 	}
 	return wrapped, nil
 }
 
-func buildClient(r *Request) *http.Client {
+func buildClient(r *Request) (*http.Client, error) {
 	c := &http.Client{}
+	if r.httpClient != nil {
+		*c = *r.httpClient
+	}
+	if r.transport != nil {
+		c.Transport = r.transport
+	}
 	if r.timeout > 0 {
 		c.Timeout = r.timeout
 	}
-	if r.proxy != nil {
-		if base, ok := http.DefaultTransport.(*http.Transport); ok {
-			tr := base.Clone()
-			tr.Proxy = http.ProxyURL(r.proxy)
+	if r.sharedTransport != nil && !r.transportChanged {
+		c.Transport = r.sharedTransport
+	} else {
+		tr, err := buildTransport(r, c.Transport)
+		if err != nil {
+			return nil, err
+		}
+		if tr != nil {
+			// The transport is discarded after this request, so don't keep its connections open.
+			tr.DisableKeepAlives = true
 			c.Transport = tr
-		} else {
-			c.Transport = &http.Transport{Proxy: http.ProxyURL(r.proxy)}
 		}
 	}
-	if r.redirectMax != nil {
+	switch {
+	case r.redirectPolicy != nil:
+		c.CheckRedirect = r.redirectPolicy.checkRedirect
+	case r.redirectMax != nil:
 		max := *r.redirectMax
 		c.CheckRedirect = func(req *http.Request, via []*http.Request) error {
 			if max <= 0 {
@@ -116,41 +171,122 @@ func buildClient(r *Request) *http.Client {
 			return nil
 		}
 	}
-	return c
+	return c, nil
 }
 
-func classifyErr(err error) error {
-	if errors.Is(err, context.DeadlineExceeded) {
-		return fmt.Errorf("%w: %v", ErrTimeout, err)
+// buildTransport returns a clone of base with the transport options of r applied,
+// or nil when r has none and base can be used as is.
+func buildTransport(r *Request, base http.RoundTripper) (*http.Transport, error) {
+	dial := r.dialContext()
+	if r.proxy == nil && r.proxyFunc == nil && r.proxyConnectHeader == nil && r.tlsConfig == nil && dial == nil &&
+		r.protocols == nil && r.http2Config == nil {
+		return nil, nil
 	}
-	if ne, ok := err.(net.Error); ok && ne.Timeout() {
-		return fmt.Errorf("%w: %v", ErrTimeout, err)
+	tr, err := cloneTransport(base)
+	if err != nil {
+		return nil, err
 	}
-	return fmt.Errorf("%w: %v", ErrNetwork, err)
+	if dial != nil {
+		tr.DialContext = dial
+	}
+	switch {
+	case r.proxy != nil && r.proxy.Scheme == "socks5":
+		// net/http leaves name resolution to SOCKS5 proxies, so socks5 dials the proxy itself.
+		tr.Proxy = nil
+		if tr.DialContext, err = socks5Dialer(r.proxy, tr.DialContext, r.resolver); err != nil {
+			return nil, err
+		}
+	case r.proxy != nil:
+		tr.Proxy = http.ProxyURL(r.proxy)
+	case r.proxyFunc != nil:
+		tr.Proxy = r.proxyFunc
+	}
+	if r.proxyConnectHeader != nil {
+		h := tr.ProxyConnectHeader.Clone()
+		if h == nil {
+			h = make(http.Header)
+		}
+		for k, v := range r.proxyConnectHeader {
+			h[k] = v
+		}
+		tr.ProxyConnectHeader = h
+	}
+	if r.tlsConfig != nil {
+		tr.TLSClientConfig = r.tlsConfig
+	}
+	if r.protocols != nil {
+		tr.Protocols = r.protocols
+	}
+	if r.http2Config != nil {
+		tr.HTTP2 = r.http2Config
+	}
+	return tr, nil
 }
 
-type gzipReadCloser struct {
-	*gzip.Reader
-	closer io.Closer
+// socks5Dialer returns a dial function that connects through the SOCKS5 proxy u using forward,
+// or a net.Dialer when forward is nil. Host names are resolved locally with resolver, or the
+// system resolver when it is nil, and the proxy is asked to connect to the address.
+func socks5Dialer(u *url.URL, forward func(ctx context.Context, network, addr string) (net.Conn, error), resolver Resolver) (func(ctx context.Context, network, addr string) (net.Conn, error), error) {
+	if forward == nil {
+		d := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+		forward = d.DialContext
+	}
+	d, err := proxy.FromURL(u, contextDialer(forward))
+	if err != nil {
+		return nil, err
+	}
+	cd, ok := d.(proxy.ContextDialer)
+	if !ok {
+		return nil, fmt.Errorf("proxy dialer %T does not support contexts", d)
+	}
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return dialResolved(ctx, resolver, cd.DialContext, network, addr)
+	}, nil
+}
+
+// contextDialer adapts a dial function to proxy.Dialer and proxy.ContextDialer.
+type contextDialer func(ctx context.Context, network, addr string) (net.Conn, error)
+
+func (d contextDialer) Dial(network, addr string) (net.Conn, error) {
+	return d(context.Background(), network, addr)
 }
 
-func (g gzipReadCloser) Close() error {
-	err := g.Reader.Close()
-	if cerr := g.closer.Close(); cerr != nil {
-		return cerr
+func (d contextDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return d(ctx, network, addr)
+}
+
+// cloneTransport returns a copy of rt that per-request options can modify.
+// A nil rt means http.DefaultTransport.
+func cloneTransport(rt http.RoundTripper) (*http.Transport, error) {
+	if rt == nil {
+		if base, ok := http.DefaultTransport.(*http.Transport); ok {
+			return base.Clone(), nil
+		}
+		return &http.Transport{}, nil
 	}
-	return err
+	tr, ok := rt.(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf("transport options need an *http.Transport, got %T", rt)
+	}
+	return tr.Clone(), nil
 }
 
-func isGzipEncoded(h http.Header) bool {
-	enc := h.Get("Content-Encoding")
-	if enc == "" {
-		return false
+func classifyErr(err error) error {
+	if errors.Is(err, ErrResponse) {
+		return err
 	}
-	for part := range strings.SplitSeq(enc, ",") {
-		if strings.EqualFold(strings.TrimSpace(part), "gzip") {
-			return true
-		}
+	var re *redirectError
+	if errors.As(err, &re) {
+		return fmt.Errorf("%w: %v", ErrRedirect, err)
 	}
-	return false
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %v", ErrTimeout, err)
+	}
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return fmt.Errorf("%w: %v", ErrTimeout, err)
+	}
+	return fmt.Errorf("%w: %v", ErrNetwork, err)
 }
@@ -2,16 +2,31 @@ package requests
 
 import (
 	"bytes"
+	"compress/flate"
 	"compress/gzip"
+	"compress/zlib"
 	"context"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
 	"io"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/http/cookiejar"
 	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -178,6 +193,167 @@ func TestGzipWithoutDecompressOption(t *testing.T) {
 	assert.Equal(t, byte(0x8b), b[1])
 }
 
+func encodeBody(t *testing.T, data []byte, encodings ...string) []byte {
+	t.Helper()
+	for _, enc := range encodings {
+		var buf bytes.Buffer
+		var w io.WriteCloser
+		switch enc {
+		case "gzip":
+			w = gzip.NewWriter(&buf)
+		case "deflate":
+			w = zlib.NewWriter(&buf)
+		case "raw-deflate":
+			w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+		case "br":
+			w = brotli.NewWriter(&buf)
+		case "zstd":
+			w, _ = zstd.NewWriter(&buf)
+		}
+		_, err := w.Write(data)
+		assert.NoError(t, err)
+		assert.NoError(t, w.Close())
+		data = buf.Bytes()
+	}
+	return data
+}
+
+func TestDecompression(t *testing.T) {
+	tests := []struct {
+		name      string
+		encodings []string
+		header    string
+		opts      []string
+		want      string
+		remaining string
+	}{
+		{name: "gzip", encodings: []string{"gzip"}, header: "gzip"},
+		{name: "zlib deflate", encodings: []string{"deflate"}, header: "deflate"},
+		{name: "raw deflate", encodings: []string{"raw-deflate"}, header: "deflate"},
+		{name: "brotli", encodings: []string{"br"}, header: "br"},
+		{name: "zstd", encodings: []string{"zstd"}, header: "zstd"},
+		{name: "stacked", encodings: []string{"gzip", "br"}, header: "gzip, br"},
+		{name: "identity", encodings: []string{"zstd"}, header: "identity, zstd"},
+		{name: "partially accepted", encodings: []string{"zstd", "gzip"}, header: "zstd, gzip", opts: []string{"gzip"}, remaining: "zstd"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var accept string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				accept = r.Header.Get("Accept-Encoding")
+				w.Header().Set("Content-Encoding", tt.header)
+				_, _ = w.Write(encodeBody(t, []byte("hello "+tt.name), tt.encodings...))
+			}))
+			defer srv.Close()
+
+			resp, err := Get(context.Background(), srv.URL, WithDecompression(tt.opts...))
+			assert.NoError(t, err)
+			b, err := resp.Bytes()
+			assert.NoError(t, err)
+			assert.Equal(t, tt.remaining, resp.Headers.Get("Content-Encoding"))
+			if tt.remaining == "" {
+				assert.Equal(t, "hello "+tt.name, string(b))
+				assert.Equal(t, "gzip, deflate, br, zstd", accept)
+			} else {
+				assert.Equal(t, encodeBody(t, []byte("hello "+tt.name), "zstd"), b)
+				assert.Equal(t, "gzip", accept)
+			}
+		})
+	}
+}
+
+func TestDecompressionBeforeMiddlewares(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		switch r.URL.Path {
+		case "/no-content":
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case "/empty":
+			w.(http.Flusher).Flush()
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodHead {
+			_, _ = w.Write(encodeBody(t, []byte(`{"ok":true}`), "gzip"))
+		}
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	rec := NewRecorder()
+	resp, err := Get(ctx, srv.URL+"/json", WithDecompressGzip(), WithMiddleware(rec.Middleware()))
+	assert.NoError(t, err)
+	text, _ := resp.Text()
+	assert.Equal(t, `{"ok":true}`, text)
+	var har bytes.Buffer
+	assert.NoError(t, rec.WriteHAR(&har))
+	assert.Contains(t, har.String(), `"text": "{\"ok\":true}"`)
+	assert.NotContains(t, har.String(), `"encoding": "base64"`)
+
+	for _, path := range []string{"/no-content", "/empty"} {
+		resp, err = Get(ctx, srv.URL+path, WithDecompression())
+		assert.NoError(t, err, path)
+		b, err := resp.Bytes()
+		assert.NoError(t, err, path)
+		assert.Empty(t, b)
+	}
+	resp, err = Head(ctx, srv.URL+"/json", WithDecompression())
+	assert.NoError(t, err)
+	assert.Equal(t, "gzip", resp.Headers.Get("Content-Encoding"))
+}
+
+func TestDecompressionOptions(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Accept-Encoding", r.Header.Get("Accept-Encoding"))
+		if r.URL.Path == "/rot" {
+			w.Header().Set("Content-Encoding", "x-rot")
+			_, _ = io.WriteString(w, "ifmmp")
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		_, _ = w.Write([]byte("not gzip"))
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	_, err := Get(ctx, srv.URL, WithDecompression("gzip"))
+	assert.ErrorIs(t, err, ErrResponse)
+
+	_, err = Get(ctx, srv.URL+"/rot", WithDecompression("x-rot"))
+	assert.ErrorIs(t, err, ErrRequest)
+	assert.ErrorContains(t, err, `unsupported content encoding "x-rot"`)
+
+	RegisterDecoder("X-Rot", func(r io.Reader) (io.ReadCloser, error) {
+		b, err := io.ReadAll(r)
+		for i := range b {
+			b[i]--
+		}
+		return io.NopCloser(bytes.NewReader(b)), err
+	})
+	resp, err := Get(ctx, srv.URL+"/rot", WithHeader("Accept-Encoding", "x-rot;q=1"), WithDecompression("x-rot"))
+	assert.NoError(t, err)
+	text, _ := resp.Text()
+	assert.Equal(t, "hello", text)
+	assert.Equal(t, "x-rot;q=1", resp.Headers.Get("X-Accept-Encoding"))
+
+	cmd, err := NewRequest(http.MethodGet, srv.URL, WithDecompression()).ToCurl()
+	assert.NoError(t, err)
+	assert.Equal(t, "curl "+srv.URL+" --compressed -L", cmd)
+
+	session := NewSession(WithDecompression())
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Go(func() {
+			resp, err := session.Get(ctx, srv.URL+"/rot")
+			if assert.NoError(t, err) {
+				assert.Equal(t, "gzip, deflate, br, zstd", resp.Headers.Get("X-Accept-Encoding"))
+			}
+		})
+	}
+	wg.Wait()
+}
+
 func TestPut(t *testing.T) {
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		assert.Equal(t, http.MethodPut, r.Method)
@@ -464,13 +640,7 @@ func (timeoutTransport) RoundTrip(*http.Request) (*http.Response, error) {
 }
 
 func TestNetworkTimeoutError(t *testing.T) {
-	prev := http.DefaultTransport
-	http.DefaultTransport = timeoutTransport{}
-	t.Cleanup(func() {
-		http.DefaultTransport = prev
-	})
-
-	_, err := Get(context.Background(), "http://example.com")
+	_, err := Get(context.Background(), "http://example.com", WithTransport(timeoutTransport{}))
 	assert.Error(t, err)
 	assert.ErrorIs(t, err, ErrTimeout)
 }
@@ -544,3 +714,2012 @@ func TestTextNilResponse(t *testing.T) {
 	_, err := resp.Text()
 	assert.ErrorIs(t, err, ErrResponseNil)
 }
+
+func TestBatchPreservesOrderAndLimitsConcurrency(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		_, _ = io.WriteString(w, r.URL.Query().Get("i"))
+	}))
+	defer srv.Close()
+
+	calls := make([]Call, 6)
+	for i := range calls {
+		calls[i] = Call{Method: http.MethodGet, URL: srv.URL, Opts: []Option{WithQuery(map[string]string{"i": strconv.Itoa(i)})}}
+	}
+
+	session := NewSession(WithHeader("X-Session", "value"))
+	results, err := session.Batch(context.Background(), calls, 2)
+	assert.NoError(t, err)
+	assert.Len(t, results, len(calls))
+	for i, res := range results {
+		assert.Equal(t, i, res.Index)
+		text, err := res.Response.Text()
+		assert.NoError(t, err)
+		assert.Equal(t, strconv.Itoa(i), text)
+	}
+	assert.LessOrEqual(t, peak.Load(), int32(2))
+}
+
+func TestBatchCollectAll(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/bad" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	results, err := Batch(context.Background(), []Call{
+		{Method: http.MethodGet, URL: srv.URL + "/bad"},
+		{Method: http.MethodGet, URL: srv.URL + "/ok"},
+	}, 0)
+	assert.ErrorIs(t, err, ErrStatus)
+	assert.ErrorIs(t, results[0].Err, ErrStatus)
+	assert.NoError(t, results[1].Err)
+}
+
+func TestBatchFailFast(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/bad" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	calls := []Call{{Method: http.MethodGet, URL: srv.URL + "/bad"}}
+	for range 3 {
+		calls = append(calls, Call{Method: http.MethodGet, URL: srv.URL + "/slow"})
+	}
+	results, err := Batch(context.Background(), calls, 1, WithFailFast())
+	assert.ErrorIs(t, err, ErrStatus)
+	for _, res := range results[1:] {
+		assert.Error(t, res.Err)
+	}
+}
+
+func TestBatchIter(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(50 * time.Millisecond)
+		}
+	}))
+	defer srv.Close()
+
+	calls := []Call{
+		{Method: http.MethodGet, URL: srv.URL + "/slow"},
+		{Method: http.MethodGet, URL: srv.URL + "/fast"},
+	}
+	var order []int
+	for res := range BatchIter(context.Background(), calls, 2) {
+		assert.NoError(t, res.Err)
+		order = append(order, res.Index)
+	}
+	assert.Equal(t, []int{1, 0}, order)
+
+	count := 0
+	for range BatchIter(context.Background(), calls, 2) {
+		count++
+		break
+	}
+	assert.Equal(t, 1, count)
+}
+
+func TestBatchBodiesReadableAfterReturn(t *testing.T) {
+	large := strings.Repeat("x", 4<<20)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, large)
+	}))
+	defer srv.Close()
+
+	calls := []Call{{Method: http.MethodGet, URL: srv.URL}, {Method: http.MethodGet, URL: srv.URL}}
+	results, err := Batch(context.Background(), calls, 0)
+	assert.NoError(t, err)
+	for _, res := range results {
+		b, err := res.Response.Bytes()
+		assert.NoError(t, err)
+		assert.Len(t, b, len(large))
+	}
+
+	var kept []*Response
+	for res := range BatchIter(context.Background(), calls, 0) {
+		kept = append(kept, res.Response)
+	}
+	for _, resp := range kept {
+		b, err := resp.Bytes()
+		assert.NoError(t, err)
+		assert.Len(t, b, len(large))
+	}
+}
+
+func TestBatchFailFastKeepsFinishedBodies(t *testing.T) {
+	large := strings.Repeat("x", 8<<20)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(100 * time.Millisecond)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = io.WriteString(w, large)
+	}))
+	defer srv.Close()
+
+	calls := []Call{{Method: http.MethodGet, URL: srv.URL + "/large"}, {Method: http.MethodGet, URL: srv.URL + "/slow"}}
+	results, err := Batch(context.Background(), calls, 0, WithFailFast())
+	assert.ErrorIs(t, err, ErrStatus)
+	b, err := results[0].Response.Bytes()
+	assert.NoError(t, err)
+	assert.Len(t, b, len(large))
+
+	var kept *Response
+	for res := range BatchIter(context.Background(), calls, 0) {
+		if res.Index == 0 {
+			kept = res.Response
+			break
+		}
+	}
+	if assert.NotNil(t, kept) {
+		b, err := kept.Bytes()
+		assert.NoError(t, err)
+		assert.Len(t, b, len(large))
+	}
+}
+
+func TestWithBaseURLAndPathParam(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v2/users/a%2Fb%20c/posts", r.URL.EscapedPath())
+		assert.Equal(t, "1", r.URL.Query().Get("page"))
+	}))
+	defer srv.Close()
+
+	session := NewSession(WithBaseURL(srv.URL + "/v2/"))
+	_, err := session.Get(context.Background(), "users/{id}/posts?page=1", WithPathParam("id", "a/b c"))
+	assert.NoError(t, err)
+}
+
+func TestPathParamRejectsDotSegments(t *testing.T) {
+	session := NewSession(WithBaseURL("https://api.example.com/v2/"))
+	for _, v := range []string{".", ".."} {
+		_, err := session.Get(context.Background(), "users/{id}/profile", WithPathParam("id", v))
+		assert.ErrorIs(t, err, ErrRequest)
+		assert.ErrorContains(t, err, "dot segment")
+	}
+
+	cmd, err := NewRequest(http.MethodGet, "https://api.example.com/users/{id}", WithPathParam("id", "..x")).ToCurl()
+	assert.NoError(t, err)
+	assert.Contains(t, cmd, "https://api.example.com/users/..x")
+}
+
+func TestWithBaseURLAbsoluteOverride(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/ok", r.URL.Path)
+	}))
+	defer srv.Close()
+
+	_, err := Get(context.Background(), srv.URL+"/ok", WithBaseURL("http://example.invalid/v2/"))
+	assert.NoError(t, err)
+}
+
+func TestWithPathParamsMissing(t *testing.T) {
+	_, err := Get(context.Background(), "http://example.com/{org}/{repo}", WithPathParams(map[string]string{"org": "x"}))
+	assert.ErrorIs(t, err, ErrRequest)
+	assert.Contains(t, err.Error(), `"repo"`)
+}
+
+func TestWithBaseURLError(t *testing.T) {
+	_, err := Get(context.Background(), "users", WithBaseURL("://invalid"))
+	assert.ErrorIs(t, err, ErrRequest)
+}
+
+type queryColor int
+
+func (c queryColor) MarshalText() ([]byte, error) {
+	return []byte([]string{"red", "green"}[c]), nil
+}
+
+type queryPage struct {
+	Page int `url:"page"`
+	Size int `url:"size,omitempty"`
+}
+
+type querySearch struct {
+	queryPage
+	Q      string     `url:"q"`
+	Tags   []string   `url:"tag"`
+	IDs    []int      `url:"ids,comma"`
+	Kinds  []string   `url:"kind,brackets"`
+	Since  time.Time  `url:"since" layout:"2006-01-02"`
+	Until  time.Time  `url:"until,unix"`
+	Limit  *int       `url:"limit,omitempty"`
+	Color  queryColor `url:"color"`
+	Filter struct {
+		Owner string `url:"owner"`
+	} `url:"filter"`
+	Ignored string `url:"-"`
+}
+
+func TestWithQueryStruct(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		assert.Equal(t, "2", q.Get("page"))
+		assert.NotContains(t, q, "size")
+		assert.Equal(t, "go", q.Get("q"))
+		assert.Equal(t, []string{"a", "b"}, q["tag"])
+		assert.Equal(t, "1,2,3", q.Get("ids"))
+		assert.Equal(t, []string{"x", "y"}, q["kind[]"])
+		assert.Equal(t, "2024-01-02", q.Get("since"))
+		assert.Equal(t, "1704153600", q.Get("until"))
+		assert.NotContains(t, q, "limit")
+		assert.Equal(t, "green", q.Get("color"))
+		assert.Equal(t, "alice", q.Get("filter[owner]"))
+		assert.NotContains(t, q, "Ignored")
+	}))
+	defer srv.Close()
+
+	day := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	in := querySearch{
+		queryPage: queryPage{Page: 2},
+		Q:         "go",
+		Tags:      []string{"a", "b"},
+		IDs:       []int{1, 2, 3},
+		Kinds:     []string{"x", "y"},
+		Since:     day,
+		Until:     day,
+		Color:     1,
+		Ignored:   "x",
+	}
+	in.Filter.Owner = "alice"
+	_, err := Get(context.Background(), srv.URL, WithQueryStruct(&in))
+	assert.NoError(t, err)
+}
+
+func TestWithFormStruct(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/x-www-form-urlencoded", r.Header.Get("Content-Type"))
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "bob", r.PostForm.Get("name"))
+		assert.Equal(t, []string{"1", "2"}, r.PostForm["n"])
+	}))
+	defer srv.Close()
+
+	in := struct {
+		Name string `url:"name"`
+		N    []int  `url:"n"`
+	}{Name: "bob", N: []int{1, 2}}
+	_, err := Post(context.Background(), srv.URL, WithFormStruct(in))
+	assert.NoError(t, err)
+}
+
+func TestWithQueryStructError(t *testing.T) {
+	_, err := Get(context.Background(), "http://example.com", WithQueryStruct("not a struct"))
+	assert.ErrorIs(t, err, ErrRequest)
+
+	bad := struct {
+		Ch chan int `url:"ch"`
+	}{Ch: make(chan int)}
+	_, err = Get(context.Background(), "http://example.com", WithQueryStruct(bad))
+	assert.ErrorIs(t, err, ErrRequest)
+}
+
+type jsonUser struct {
+	Name string `json:"name"`
+	Age  int    `json:"age,omitempty"`
+}
+
+func TestGetJSON(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Accept"))
+		_, _ = io.WriteString(w, `{"name":"alice","age":30}`)
+	}))
+	defer srv.Close()
+
+	user, resp, err := GetJSON[jsonUser](context.Background(), srv.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, jsonUser{Name: "alice", Age: 30}, user)
+}
+
+func TestPostJSON(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "application/vnd.api+json", r.Header.Get("Accept"))
+		var in jsonUser
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&in))
+		in.Age = 1
+		_ = json.NewEncoder(w).Encode(in)
+	}))
+	defer srv.Close()
+
+	session := NewSession(WithHeader("Accept", "application/vnd.api+json"))
+	out, _, err := SessionPostJSON[jsonUser, jsonUser](context.Background(), session, srv.URL, jsonUser{Name: "bob"})
+	assert.NoError(t, err)
+	assert.Equal(t, jsonUser{Name: "bob", Age: 1}, out)
+}
+
+func TestGetJSONErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = io.WriteString(w, "not json")
+	}))
+	defer srv.Close()
+
+	_, resp, err := GetJSON[jsonUser](context.Background(), srv.URL+"/missing")
+	assert.ErrorIs(t, err, ErrStatus)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	_, _, err = GetJSON[jsonUser](context.Background(), srv.URL)
+	assert.ErrorIs(t, err, ErrResponse)
+}
+
+func TestJSONHelpersEmptyBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+
+	out, resp, err := DeleteJSON[jsonUser](context.Background(), srv.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Zero(t, out)
+
+	_, _, err = PostJSON[jsonUser, jsonUser](context.Background(), srv.URL, jsonUser{})
+	assert.ErrorIs(t, err, ErrResponse)
+	assert.ErrorIs(t, err, ErrNoContent)
+}
+
+func TestJSONHelpersAcceptedStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		if r.URL.Path == "/body" {
+			_, _ = io.WriteString(w, `{"error":"not found"}`)
+		}
+	}))
+	defer srv.Close()
+
+	for _, path := range []string{"/empty", "/body"} {
+		out, resp, err := GetJSON[jsonUser](context.Background(), srv.URL+path, WithOKStatus(http.StatusNotFound))
+		assert.NoError(t, err, path)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		assert.Zero(t, out)
+	}
+}
+
+type xmlItem struct {
+	XMLName xml.Name `xml:"item"`
+	Name    string   `xml:"name"`
+}
+
+func TestWithBodyAsAndDecodeXML(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/xml", r.Header.Get("Content-Type"))
+		b, _ := io.ReadAll(r.Body)
+		assert.Equal(t, "<item><name>in</name></item>", string(b))
+		w.Header().Set("Content-Type", "application/soap+xml; charset=utf-8")
+		_, _ = io.WriteString(w, "<item><name>out</name></item>")
+	}))
+	defer srv.Close()
+
+	resp, err := Post(context.Background(), srv.URL, WithBodyAs(XMLCodec{}, xmlItem{Name: "in"}))
+	assert.NoError(t, err)
+	var out xmlItem
+	assert.NoError(t, resp.Decode(&out))
+	assert.Equal(t, "out", out.Name)
+}
+
+func TestDecodeForm(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-www-form-urlencoded")
+		_, _ = io.WriteString(w, "a=1&b=2")
+	}))
+	defer srv.Close()
+
+	resp, err := Get(context.Background(), srv.URL)
+	assert.NoError(t, err)
+	var out map[string]string
+	assert.NoError(t, resp.Decode(&out))
+	assert.Equal(t, map[string]string{"a": "1", "b": "2"}, out)
+}
+
+func TestDecodeUnknownContentType(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_, _ = io.WriteString(w, "data")
+	}))
+	defer srv.Close()
+
+	resp, err := Get(context.Background(), srv.URL)
+	assert.NoError(t, err)
+	var out any
+	assert.ErrorIs(t, resp.Decode(&out), ErrResponse)
+}
+
+type countingCodec struct {
+	JSONCodec
+	marshal, unmarshal atomic.Int32
+}
+
+func (c *countingCodec) Marshal(v any) ([]byte, error) {
+	c.marshal.Add(1)
+	return c.JSONCodec.Marshal(v)
+}
+
+func (c *countingCodec) Unmarshal(data []byte, v any) error {
+	c.unmarshal.Add(1)
+	return c.JSONCodec.Unmarshal(data, v)
+}
+
+func TestRegisterCodecSwapsJSON(t *testing.T) {
+	codec := &countingCodec{}
+	RegisterCodec("application/json", codec)
+	t.Cleanup(func() { RegisterCodec("application/json", JSONCodec{}) })
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/problem+json")
+		_, _ = io.Copy(w, r.Body)
+	}))
+	defer srv.Close()
+
+	resp, err := Post(context.Background(), srv.URL, WithJSON(map[string]string{"a": "b"}))
+	assert.NoError(t, err)
+	var out map[string]string
+	assert.NoError(t, resp.JSON(&out))
+	assert.NoError(t, resp.Decode(&out))
+	assert.Equal(t, "b", out["a"])
+	assert.Equal(t, int32(1), codec.marshal.Load())
+	assert.Equal(t, int32(2), codec.unmarshal.Load())
+}
+
+func TestStatusErrorProblemDetails(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_, _ = io.WriteString(w, `{"type":"https://example.com/probs/invalid","title":"Invalid input","status":422,"detail":"name is required","instance":"/users","field":"name"}`)
+	}))
+	defer srv.Close()
+
+	_, err := Post(context.Background(), srv.URL)
+	var se *StatusError
+	assert.ErrorAs(t, err, &se)
+	assert.NotNil(t, se.Problem)
+	assert.Equal(t, "https://example.com/probs/invalid", se.Problem.Type)
+	assert.Equal(t, 422, se.Problem.Status)
+	assert.Equal(t, "/users", se.Problem.Instance)
+	assert.Equal(t, "name", se.Problem.Extensions["field"])
+	assert.Equal(t, "unexpected status: 422: Invalid input: name is required", err.Error())
+}
+
+func TestStatusErrorProblemDetailsIgnoresOtherTypes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = io.WriteString(w, `{"title":"x"}`)
+	}))
+	defer srv.Close()
+
+	_, err := Get(context.Background(), srv.URL)
+	var se *StatusError
+	assert.ErrorAs(t, err, &se)
+	assert.Nil(t, se.Problem)
+}
+
+func TestProblemDetailsInvalidMemberType(t *testing.T) {
+	var p ProblemDetails
+	assert.NoError(t, json.Unmarshal([]byte(`{"title":1,"status":"bad","detail":"d"}`), &p))
+	assert.Equal(t, "", p.Title)
+	assert.Equal(t, 0, p.Status)
+	assert.Equal(t, "d", p.Detail)
+
+	b, err := json.Marshal(p)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"detail":"d"}`, string(b))
+}
+
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *apiError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+func TestWithErrorResult(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		_, _ = io.WriteString(w, `{"code":"conflict","message":"already exists"}`)
+	}))
+	defer srv.Close()
+
+	var proto apiError
+	s := NewSession(WithErrorResult(&proto))
+	_, err := s.Post(context.Background(), srv.URL)
+	assert.ErrorIs(t, err, ErrStatus)
+	assert.Equal(t, ErrStatus, errors.Unwrap(err))
+	var ae *apiError
+	assert.ErrorAs(t, err, &ae)
+	assert.Equal(t, "conflict", ae.Code)
+	assert.Equal(t, "already exists", ae.Message)
+	assert.Zero(t, proto)
+	assert.Contains(t, err.Error(), `"message":"already exists"`)
+
+	_, err = s.Post(context.Background(), srv.URL)
+	var ae2 *apiError
+	assert.ErrorAs(t, err, &ae2)
+	assert.NotSame(t, ae, ae2)
+
+	_, err = Post(context.Background(), srv.URL, WithErrorResult(apiError{}))
+	assert.ErrorIs(t, err, ErrRequest)
+}
+
+func TestWithErrorDecoderOnSession(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_, _ = io.WriteString(w, `{"code":"bad","message":"`+r.URL.Query().Get("m")+`"}`)
+	}))
+	defer srv.Close()
+
+	session := NewSession(WithErrorDecoder(func(resp *Response) any {
+		var e apiError
+		if resp.JSON(&e) != nil {
+			return nil
+		}
+		return &e
+	}))
+	_, err1 := session.Get(context.Background(), srv.URL, WithQuery(map[string]string{"m": "one"}))
+	_, err2 := session.Get(context.Background(), srv.URL, WithQuery(map[string]string{"m": "two"}))
+	var ae1, ae2 *apiError
+	assert.ErrorAs(t, err1, &ae1)
+	assert.ErrorAs(t, err2, &ae2)
+	assert.Equal(t, "one", ae1.Message)
+	assert.Equal(t, "two", ae2.Message)
+}
+
+func TestStatusErrorSnippetIsBounded(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = io.WriteString(w, "line one\nline two "+strings.Repeat("x", 1000))
+	}))
+	defer srv.Close()
+
+	_, err := Get(context.Background(), srv.URL)
+	assert.Error(t, err)
+	msg := err.Error()
+	assert.True(t, strings.HasPrefix(msg, "unexpected status: 500: line one line two xxx"))
+	assert.True(t, strings.HasSuffix(msg, "..."))
+	assert.Less(t, len(msg), 300)
+}
+
+// countingReader serves n 'x' bytes and counts how many have been read.
+type countingReader struct {
+	n, read int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	if c.read >= c.n {
+		return 0, io.EOF
+	}
+	p = p[:min(int64(len(p)), c.n-c.read)]
+	for i := range p {
+		p[i] = 'x'
+	}
+	c.read += int64(len(p))
+	return len(p), nil
+}
+
+func TestStatusErrorReadsBoundedBody(t *testing.T) {
+	large := func(contentType string, body *countingReader) Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				return &http.Response{
+					StatusCode: http.StatusBadGateway,
+					Header:     http.Header{"Content-Type": {contentType}},
+					Body:       io.NopCloser(body),
+					Request:    req,
+				}, nil
+			})
+		}
+	}
+
+	body := &countingReader{n: 64 << 20}
+	resp, err := Get(context.Background(), "http://api.test/", WithMiddleware(large("text/plain", body)))
+	assert.ErrorIs(t, err, ErrStatus)
+	assert.Less(t, body.read, int64(1024))
+	assert.True(t, strings.HasSuffix(err.Error(), "..."))
+	b, err := resp.Bytes()
+	assert.NoError(t, err)
+	assert.Len(t, b, 64<<20)
+
+	body = &countingReader{n: 64 << 20}
+	_, err = Get(context.Background(), "http://api.test/", WithMiddleware(large("application/json", body)), WithErrorResult(&apiError{}))
+	assert.ErrorIs(t, err, ErrStatus)
+	assert.LessOrEqual(t, body.read, int64(maxErrorBody+1))
+	var se *StatusError
+	if assert.ErrorAs(t, err, &se) {
+		assert.Nil(t, se.Result)
+	}
+}
+
+func TestWithOKStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusGone)
+		}
+	}))
+	defer srv.Close()
+
+	session := NewSession(WithOKStatus(http.StatusNotFound))
+	resp, err := session.Get(context.Background(), srv.URL+"/missing")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	_, err = session.Get(context.Background(), srv.URL+"/gone")
+	assert.ErrorIs(t, err, ErrStatus)
+}
+
+func TestWithStatusValidator(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/created" {
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		w.WriteHeader(http.StatusNotModified)
+	}))
+	defer srv.Close()
+
+	onlyOK := WithStatusValidator(func(code int) bool { return code == http.StatusOK || code == http.StatusNotModified })
+	_, err := Get(context.Background(), srv.URL+"/cached", onlyOK)
+	assert.NoError(t, err)
+	_, err = Get(context.Background(), srv.URL+"/created", onlyOK)
+	assert.ErrorIs(t, err, ErrStatus)
+}
+
+func TestWithNoStatusError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	resp, err := Get(context.Background(), srv.URL, WithNoStatusError())
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+}
+
+func decodeLogRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var rec map[string]any
+		assert.NoError(t, dec.Decode(&rec))
+		records = append(records, rec)
+	}
+	return records
+}
+
+func TestWithLogger(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		assert.Equal(t, `{"name":"alice"}`, string(b))
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "sid=secret")
+		_, _ = io.WriteString(w, `{"id":"1234567890"}`)
+	}))
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	session := NewSession(WithLogger(logger, LogBodies(10), LogRedactHeaders("X-Internal")))
+	resp, err := session.Post(context.Background(), srv.URL+"?access_token=abc&page=1",
+		WithHeader("Authorization", "Bearer abc"),
+		WithHeader("X-Internal", "hidden"),
+		WithHeader("X-Trace", "visible"),
+		WithJSON(map[string]string{"name": "alice"}),
+	)
+	assert.NoError(t, err)
+	text, err := resp.Text()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"id":"1234567890"}`, text)
+
+	records := decodeLogRecords(t, &buf)
+	assert.Len(t, records, 2)
+
+	req := records[0]
+	assert.Equal(t, "http request", req["msg"])
+	assert.Equal(t, "DEBUG", req["level"])
+	assert.Equal(t, http.MethodPost, req["method"])
+	assert.Contains(t, req["url"], "access_token=REDACTED")
+	assert.Contains(t, req["url"], "page=1")
+	headers := req["headers"].(map[string]any)
+	assert.Equal(t, []any{"REDACTED"}, headers["Authorization"])
+	assert.Equal(t, []any{"REDACTED"}, headers["X-Internal"])
+	assert.Equal(t, []any{"visible"}, headers["X-Trace"])
+	assert.Equal(t, `{"name":"a...`, req["body"])
+
+	res := records[1]
+	assert.Equal(t, "http response", res["msg"])
+	assert.Equal(t, float64(http.StatusOK), res["status"])
+	assert.Equal(t, float64(len(text)), res["bytes"])
+	assert.Equal(t, `{"id":"123...`, res["body"])
+	assert.Equal(t, []any{"REDACTED"}, res["headers"].(map[string]any)["Set-Cookie"])
+	assert.NotContains(t, buf.String(), "Bearer abc")
+}
+
+func TestWithLoggerStreamsBodies(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/events" {
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = io.WriteString(w, "data: 1\n\n")
+			w.(http.Flusher).Flush()
+			<-release
+			_, _ = io.WriteString(w, "data: 2\n\n")
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = io.Copy(w, r.Body)
+	}))
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The call returns while the stream is still open; the response is logged once it ends.
+	resp, err := Get(ctx, srv.URL+"/events", WithLogger(logger, LogBodies(4)))
+	close(release)
+	assert.NoError(t, err)
+	assert.Len(t, decodeLogRecords(t, bytes.NewBuffer(buf.Bytes())), 1)
+	text, err := resp.Text()
+	assert.NoError(t, err)
+	assert.Equal(t, "data: 1\n\ndata: 2\n\n", text)
+	records := decodeLogRecords(t, &buf)
+	if assert.Len(t, records, 2) {
+		assert.Equal(t, "http response", records[1]["msg"])
+		assert.Equal(t, "data...", records[1]["body"])
+		assert.Equal(t, float64(len(text)), records[1]["bytes"])
+	}
+
+	// A body without GetBody is captured while it is sent.
+	resp, err = Post(ctx, srv.URL+"/echo", WithLogger(logger, LogBodies(5)),
+		WithHeader("Content-Type", "text/plain"), WithBody(io.MultiReader(strings.NewReader("hello world"))))
+	assert.NoError(t, err)
+	text, _ = resp.Text()
+	assert.Equal(t, "hello world", text)
+	records = decodeLogRecords(t, &buf)
+	if assert.Len(t, records, 2) {
+		assert.Equal(t, "http request", records[0]["msg"])
+		assert.Equal(t, "hello...", records[0]["body"])
+		assert.Equal(t, "hello...", records[1]["body"])
+	}
+}
+
+func TestWithLoggerLevels(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+	_, err := Get(context.Background(), srv.URL, WithLogger(logger, LogErrorLevel(slog.LevelWarn)))
+	assert.ErrorIs(t, err, ErrStatus)
+	_, err = Get(context.Background(), "http://localhost:9999", WithLogger(logger, LogLevel(slog.LevelInfo)))
+	assert.ErrorIs(t, err, ErrNetwork)
+
+	records := decodeLogRecords(t, &buf)
+	assert.Len(t, records, 3)
+	assert.Equal(t, "http response", records[0]["msg"])
+	assert.Equal(t, "WARN", records[0]["level"])
+	assert.Equal(t, "http request", records[1]["msg"])
+	assert.Equal(t, "INFO", records[1]["level"])
+	assert.Equal(t, "http request failed", records[2]["msg"])
+	assert.Equal(t, "ERROR", records[2]["level"])
+	assert.Contains(t, records[2]["error"], "network error")
+}
+
+func TestWithTraceTimings(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Flusher).Flush()
+		time.Sleep(20 * time.Millisecond)
+		_, _ = io.WriteString(w, "done")
+	}))
+	defer srv.Close()
+
+	resp, err := Get(context.Background(), srv.URL, WithTrace())
+	assert.NoError(t, err)
+	before := resp.Timings()
+	assert.Zero(t, before.Transfer)
+	assert.Equal(t, before.FirstByte, before.Total)
+
+	_, err = resp.Text()
+	assert.NoError(t, err)
+	tm := resp.Timings()
+	assert.False(t, tm.Reused)
+	assert.Equal(t, srv.Listener.Addr().String(), tm.RemoteAddr)
+	assert.Greater(t, tm.Connect, time.Duration(0))
+	assert.Greater(t, tm.FirstByte, time.Duration(0))
+	assert.GreaterOrEqual(t, tm.Transfer, 20*time.Millisecond)
+	assert.GreaterOrEqual(t, tm.Total, tm.FirstByte+tm.Transfer)
+
+	resp, err = Get(context.Background(), srv.URL, WithTrace())
+	assert.NoError(t, err)
+	_, _ = resp.Bytes()
+	assert.True(t, resp.Timings().Reused)
+	assert.Zero(t, resp.Timings().Connect)
+}
+
+func TestTimingsWithoutTrace(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	resp, err := Get(context.Background(), srv.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, Timings{}, resp.Timings())
+}
+
+func TestWithMiddleware(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "outer,inner", r.Header.Get("X-Chain"))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	var order []string
+	tag := func(name string) Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				order = append(order, name)
+				req = req.Clone(req.Context())
+				if v := req.Header.Get("X-Chain"); v != "" {
+					name = v + "," + name
+				}
+				req.Header.Set("X-Chain", name)
+				resp, err := next.RoundTrip(req)
+				order = append(order, name+" done")
+				return resp, err
+			})
+		}
+	}
+
+	session := NewSession(WithMiddleware(tag("outer")))
+	resp, err := session.Get(context.Background(), srv.URL, WithMiddleware(tag("inner")))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.Equal(t, []string{"outer", "inner", "outer,inner done", "outer done"}, order)
+}
+
+func TestWithMiddlewareShortCircuit(t *testing.T) {
+	fail := func(http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(*http.Request) (*http.Response, error) {
+			return nil, timeoutErr{}
+		})
+	}
+	_, err := Get(context.Background(), "http://example.invalid", WithMiddleware(fail))
+	assert.ErrorIs(t, err, ErrTimeout)
+}
+
+func TestMetricsCollector(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	collector := NewMetricsCollector(0.5, 1)
+	session := NewSession(WithMetrics(collector))
+	ctx := context.Background()
+	resp, err := session.Get(ctx, srv.URL)
+	assert.NoError(t, err)
+	_, _ = resp.Bytes()
+	resp, err = session.Get(ctx, srv.URL)
+	assert.NoError(t, err)
+	_, _ = resp.Bytes()
+	_, err = session.Get(ctx, srv.URL+"/missing")
+	assert.ErrorIs(t, err, ErrStatus)
+	_, err = session.Post(ctx, "http://localhost:9999")
+	assert.ErrorIs(t, err, ErrNetwork)
+
+	var buf bytes.Buffer
+	n, err := collector.WriteTo(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(buf.Len()), n)
+	out := buf.String()
+	host := srv.Listener.Addr().String()
+	assert.Contains(t, out, "# TYPE http_client_requests_total counter\n")
+	assert.Contains(t, out, fmt.Sprintf("http_client_requests_total{method=\"GET\",host=%q,status=\"2xx\"} 2\n", host))
+	assert.Contains(t, out, fmt.Sprintf("http_client_requests_total{method=\"GET\",host=%q,status=\"4xx\"} 1\n", host))
+	assert.Contains(t, out, "http_client_requests_total{method=\"POST\",host=\"localhost:9999\",status=\"error\"} 1\n")
+	assert.Contains(t, out, fmt.Sprintf("http_client_request_duration_seconds_bucket{method=\"GET\",host=%q,le=\"0.5\"} 3\n", host))
+	assert.Contains(t, out, fmt.Sprintf("http_client_request_duration_seconds_bucket{method=\"GET\",host=%q,le=\"+Inf\"} 3\n", host))
+	assert.Contains(t, out, fmt.Sprintf("http_client_request_duration_seconds_count{method=\"GET\",host=%q} 3\n", host))
+	assert.Contains(t, out, fmt.Sprintf("http_client_requests_in_flight{method=\"GET\",host=%q} 0\n", host))
+	assert.Contains(t, out, fmt.Sprintf("http_client_connections_total{host=%q,reused=\"true\"} 2\n", host))
+	assert.Contains(t, out, fmt.Sprintf("http_client_connections_total{host=%q,reused=\"false\"} 1\n", host))
+
+	rec := httptest.NewRecorder()
+	collector.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Equal(t, out, rec.Body.String())
+}
+
+type recordingMetrics struct {
+	started  atomic.Int32
+	finished []RequestMetrics
+}
+
+func (m *recordingMetrics) RequestStarted(string, string) { m.started.Add(1) }
+func (m *recordingMetrics) RequestFinished(rm RequestMetrics) {
+	m.finished = append(m.finished, rm)
+}
+
+func TestWithMetricsHook(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	m := &recordingMetrics{}
+	_, err := Put(context.Background(), srv.URL, WithMetrics(m))
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), m.started.Load())
+	assert.Len(t, m.finished, 1)
+	assert.Equal(t, http.MethodPut, m.finished[0].Method)
+	assert.Equal(t, srv.Listener.Addr().String(), m.finished[0].Host)
+	assert.Equal(t, http.StatusCreated, m.finished[0].StatusCode)
+	assert.Greater(t, m.finished[0].Duration, time.Duration(0))
+}
+
+func TestRequestToCurl(t *testing.T) {
+	req := NewRequest(http.MethodPost, "https://api.example.com/users",
+		WithQuery(map[string]string{"token": "abc"}),
+		WithHeader("Authorization", "Bearer secret"),
+		WithJSON(map[string]string{"name": "o'neil"}),
+		WithCookies(&http.Cookie{Name: "sid", Value: "1"}),
+		WithTimeout(1500*time.Millisecond),
+		WithRedirect(0),
+	)
+	cmd, err := req.ToCurl()
+	assert.NoError(t, err)
+	assert.Equal(t, `curl -X POST 'https://api.example.com/users?token=abc'`+
+		` -H 'Authorization: Bearer secret' -H 'Content-Type: application/json' -H 'Cookie: sid=1'`+
+		` --data-binary '{"name":"o'\''neil"}' --max-time 1.5`, cmd)
+
+	redactedCmd, err := req.ToCurl(CurlRedact())
+	assert.NoError(t, err)
+	assert.Contains(t, redactedCmd, `'https://api.example.com/users?token=REDACTED'`)
+	assert.Contains(t, redactedCmd, `-H 'Authorization: REDACTED'`)
+	assert.Contains(t, redactedCmd, `-H 'Cookie: REDACTED'`)
+	assert.NotContains(t, redactedCmd, "secret")
+}
+
+func TestRequestToCurlKeepsBodyReplayable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(b)
+	}))
+	defer srv.Close()
+
+	req := NewRequest(http.MethodPut, srv.URL, WithBody(io.NopCloser(strings.NewReader("payload"))))
+	cmd, err := req.ToCurl(CurlMultiline())
+	assert.NoError(t, err)
+	assert.Equal(t, "curl \\\n  -X PUT \\\n  "+srv.URL+" \\\n  --data-binary payload \\\n  -L", cmd)
+
+	resp, err := req.Do(context.Background())
+	assert.NoError(t, err)
+	text, _ := resp.Text()
+	assert.Equal(t, "payload", text)
+
+	s := NewSession(WithHeader("X-Tenant", "t1"))
+	req = s.NewRequest(http.MethodPost, srv.URL, WithBody(strings.NewReader("from session")))
+	cmd, err = req.ToCurl()
+	assert.NoError(t, err)
+	assert.Contains(t, cmd, "-H 'X-Tenant: t1'")
+	resp, err = req.Do(context.Background())
+	assert.NoError(t, err)
+	text, _ = resp.Text()
+	assert.Equal(t, "from session", text)
+	assert.Equal(t, "t1", resp.Request.Headers.Get("X-Tenant"))
+}
+
+func TestRequestDoTwice(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(b)
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	for _, opt := range []Option{
+		WithJSON(map[string]int{"a": 1}),
+		WithForm(map[string]string{"a": "1"}),
+		WithBody(bytes.NewBufferString("buffered")),
+	} {
+		req := NewRequest(http.MethodPost, srv.URL, opt)
+		first, err := req.Do(ctx)
+		assert.NoError(t, err)
+		want, _ := first.Text()
+		assert.NotEmpty(t, want)
+		second, err := req.Do(ctx)
+		assert.NoError(t, err)
+		text, _ := second.Text()
+		assert.Equal(t, want, text)
+		cmd, err := req.ToCurl()
+		assert.NoError(t, err)
+		assert.Contains(t, cmd, want)
+	}
+
+	req := NewRequest(http.MethodPost, srv.URL, WithBody(io.NopCloser(strings.NewReader("stream"))))
+	_, err := req.Do(ctx)
+	assert.NoError(t, err)
+	_, err = req.Do(ctx)
+	assert.ErrorIs(t, err, ErrRequest)
+	assert.ErrorContains(t, err, "already sent")
+	_, err = req.ToCurl()
+	assert.ErrorIs(t, err, ErrRequest)
+}
+
+func TestResponseCurlCommand(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	resp, err := Post(context.Background(), srv.URL+"/items",
+		WithForm(map[string]string{"a": "1"}),
+		WithProxy(strings.Replace(srv.URL, "http://", "http://user:pass@", 1)),
+		WithRedirect(3),
+		WithDecompressGzip(),
+	)
+	assert.Error(t, err)
+	if !assert.NotNil(t, resp) {
+		return
+	}
+	cmd, err := resp.CurlCommand(CurlRedact())
+	assert.NoError(t, err)
+	assert.Equal(t, "curl -X POST "+srv.URL+"/items -H 'Content-Type: application/x-www-form-urlencoded'"+
+		" --data-binary a=1 -x "+strings.Replace(srv.URL, "http://", "http://user:xxxxx@", 1)+" --compressed -L --max-redirs 3", cmd)
+
+	var nilResp *Response
+	_, err = nilResp.CurlCommand()
+	assert.ErrorIs(t, err, ErrResponseNil)
+}
+
+func TestWithInsecureSkipVerify(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	_, err := Get(context.Background(), srv.URL)
+	assert.ErrorIs(t, err, ErrNetwork)
+	_, err = Get(context.Background(), srv.URL, WithInsecureSkipVerify())
+	assert.NoError(t, err)
+}
+
+func TestWithTLSConfig(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	cfg := srv.Client().Transport.(*http.Transport).TLSClientConfig
+	_, err := Get(context.Background(), srv.URL, WithTLSConfig(cfg))
+	assert.NoError(t, err)
+}
+
+func TestFromCurl(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/api/items", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "Mozilla/5.0", r.Header.Get("User-Agent"))
+		user, pass, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "alice", user)
+		assert.Equal(t, "s3cret", pass)
+		c, err := r.Cookie("sid")
+		assert.NoError(t, err)
+		assert.Equal(t, "abc", c.Value)
+		b, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(b)
+	}))
+	defer srv.Close()
+
+	cmd := `curl '` + srv.URL + `/api/items' \
+  -H 'content-type: application/json' \
+  -H "user-agent: Mozilla/5.0" \
+  -b 'sid=abc' -u alice:s3cret \
+  --data-raw $'{"name":"it\'s"}' \
+  --compressed -sS`
+	method, rawURL, opts, err := FromCurl(cmd)
+	assert.NoError(t, err)
+	assert.Equal(t, http.MethodPost, method)
+	assert.Equal(t, srv.URL+"/api/items", rawURL)
+
+	resp, err := NewSession().Do(context.Background(), method, rawURL, opts...)
+	assert.NoError(t, err)
+	text, _ := resp.Text()
+	assert.Equal(t, `{"name":"it's"}`, text)
+}
+
+func TestFromCurlFlags(t *testing.T) {
+	tests := []struct {
+		name   string
+		cmd    string
+		method string
+		url    string
+		header http.Header
+		body   string
+	}{
+		{
+			name:   "explicit method attached",
+			cmd:    `curl -XDELETE example.com/x`,
+			method: http.MethodDelete,
+			url:    "http://example.com/x",
+		},
+		{
+			name:   "data defaults to form",
+			cmd:    `curl -d a=1 --data 'b=2' https://example.com`,
+			method: http.MethodPost,
+			url:    "https://example.com",
+			header: http.Header{"Content-Type": {"application/x-www-form-urlencoded"}},
+			body:   "a=1&b=2",
+		},
+		{
+			name:   "urlencode",
+			cmd:    `curl --data-urlencode 'q=a b&c' --data-urlencode '=x+y' https://example.com`,
+			method: http.MethodPost,
+			url:    "https://example.com",
+			body:   "q=a%20b%26c&x%2By",
+		},
+		{
+			name:   "get moves data to query",
+			cmd:    `curl -G -d a=1 'https://example.com/s?x=0'`,
+			method: http.MethodGet,
+			url:    "https://example.com/s?x=0&a=1",
+		},
+		{
+			name:   "head",
+			cmd:    `curl -sI --url https://example.com`,
+			method: http.MethodHead,
+			url:    "https://example.com",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method, rawURL, opts, err := FromCurl(tt.cmd)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.method, method)
+			req := NewRequest(method, rawURL, opts...)
+			assert.NoError(t, req.err)
+			assert.Equal(t, tt.url, rawURL)
+			for k := range tt.header {
+				assert.Equal(t, tt.header.Get(k), req.headers.Get(k))
+			}
+			if tt.body != "" {
+				b, _ := io.ReadAll(req.body)
+				assert.Equal(t, tt.body, string(b))
+			}
+		})
+	}
+}
+
+func TestFromCurlRedirectsAndForm(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new", http.StatusFound)
+			return
+		}
+		assert.NoError(t, r.ParseMultipartForm(1<<20))
+		_, _ = io.WriteString(w, r.FormValue("name"))
+	}))
+	defer srv.Close()
+
+	method, rawURL, opts, err := FromCurl("curl " + srv.URL + "/old -F name=gopher")
+	assert.NoError(t, err)
+	resp, err := Do(context.Background(), method, rawURL, opts...)
+	assert.ErrorIs(t, err, ErrStatus)
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+
+	method, rawURL, opts, err = FromCurl("curl -L " + srv.URL + "/new -F name=gopher")
+	assert.NoError(t, err)
+	resp, err = Do(context.Background(), method, rawURL, opts...)
+	assert.NoError(t, err)
+	text, _ := resp.Text()
+	assert.Equal(t, "gopher", text)
+}
+
+func TestFromCurlOptionsReusable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+			assert.NoError(t, r.ParseMultipartForm(1<<20))
+			_, _ = io.WriteString(w, r.FormValue("name"))
+			return
+		}
+		_, _ = io.Copy(w, r.Body)
+	}))
+	defer srv.Close()
+
+	s := NewSession()
+	for _, tt := range []struct{ cmd, want string }{
+		{"curl " + srv.URL + " -d a=1", "a=1"},
+		{"curl " + srv.URL + " -F name=gopher", "gopher"},
+	} {
+		method, rawURL, opts, err := FromCurl(tt.cmd)
+		assert.NoError(t, err)
+		for range 2 {
+			resp, err := s.Do(context.Background(), method, rawURL, opts...)
+			assert.NoError(t, err)
+			text, _ := resp.Text()
+			assert.Equal(t, tt.want, text)
+		}
+	}
+}
+
+func TestFromCurlHeaders(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, strings.Join(r.Header.Values("Accept"), ",")+"|"+r.Header.Get("Authorization"))
+	}))
+	defer srv.Close()
+
+	s := NewSession(WithHeader("Accept", "text/plain"))
+	method, rawURL, opts, err := FromCurl("curl " + srv.URL + " -H 'Accept: application/json' -H 'Accept: application/xml' -u alice:secret -H 'Authorization: Bearer t'")
+	assert.NoError(t, err)
+	resp, err := s.Do(context.Background(), method, rawURL, opts...)
+	assert.NoError(t, err)
+	text, _ := resp.Text()
+	assert.Equal(t, "application/json,application/xml|Bearer t", text)
+
+	method, rawURL, opts, err = FromCurl("curl " + srv.URL + " -u alice:secret")
+	assert.NoError(t, err)
+	resp, err = Do(context.Background(), method, rawURL, opts...)
+	assert.NoError(t, err)
+	text, _ = resp.Text()
+	assert.Equal(t, "|Basic YWxpY2U6c2VjcmV0", text)
+}
+
+func TestFromCurlErrors(t *testing.T) {
+	for _, cmd := range []string{
+		"wget https://example.com",
+		"curl",
+		"curl --bogus https://example.com",
+		"curl -H",
+		"curl 'https://example.com",
+		"curl -b cookies.txt https://example.com",
+	} {
+		_, _, _, err := FromCurl(cmd)
+		assert.ErrorIs(t, err, ErrRequest, cmd)
+	}
+}
+
+func TestRecorderWriteHAR(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new?page=2", http.StatusFound)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "sid", Value: "secret", Path: "/", HttpOnly: true})
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"ok":true}`)
+	}))
+	defer srv.Close()
+
+	rec := NewRecorder(HARBodyLimit(4), HARRedactHeaders("X-Internal"))
+	s := NewSession(WithMiddleware(rec.Middleware()), WithHeader("Authorization", "Bearer token"))
+
+	resp, err := s.Post(context.Background(), srv.URL+"/items?api_key=k&q=a+b",
+		WithJSON(map[string]int{"n": 1}), WithHeader("X-Internal", "1"))
+	assert.NoError(t, err)
+	_, _ = resp.Bytes()
+	resp, err = s.Get(context.Background(), srv.URL+"/old")
+	assert.NoError(t, err)
+	_, _ = resp.Bytes()
+
+	var buf bytes.Buffer
+	assert.NoError(t, rec.WriteHAR(&buf))
+	assert.NotContains(t, buf.String(), "Bearer token")
+	assert.NotContains(t, buf.String(), "secret")
+
+	var doc struct {
+		Log struct {
+			Version string `json:"version"`
+			Entries []struct {
+				Time    float64 `json:"time"`
+				Request struct {
+					Method      string  `json:"method"`
+					URL         string  `json:"url"`
+					Headers     []harNV `json:"headers"`
+					QueryString []harNV `json:"queryString"`
+					PostData    *struct {
+						MimeType string `json:"mimeType"`
+						Text     string `json:"text"`
+						Comment  string `json:"comment"`
+					} `json:"postData"`
+				} `json:"request"`
+				Response struct {
+					Status      int         `json:"status"`
+					Cookies     []harCookie `json:"cookies"`
+					RedirectURL string      `json:"redirectURL"`
+					Content     harContent  `json:"content"`
+				} `json:"response"`
+				Timings map[string]float64 `json:"timings"`
+			} `json:"entries"`
+		} `json:"log"`
+	}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &doc))
+	assert.Equal(t, "1.2", doc.Log.Version)
+	if !assert.Len(t, doc.Log.Entries, 3) {
+		return
+	}
+
+	post := doc.Log.Entries[0]
+	assert.Equal(t, http.MethodPost, post.Request.Method)
+	assert.Contains(t, post.Request.URL, "api_key=REDACTED")
+	assert.Equal(t, []harNV{{"api_key", "REDACTED"}, {"q", "a b"}}, post.Request.QueryString)
+	assert.Contains(t, post.Request.Headers, harNV{"Authorization", "REDACTED"})
+	assert.Contains(t, post.Request.Headers, harNV{"X-Internal", "REDACTED"})
+	if assert.NotNil(t, post.Request.PostData) {
+		assert.Equal(t, "application/json", post.Request.PostData.MimeType)
+		assert.Equal(t, `{"n"`, post.Request.PostData.Text)
+		assert.Equal(t, "truncated", post.Request.PostData.Comment)
+	}
+	assert.Equal(t, http.StatusOK, post.Response.Status)
+	assert.Equal(t, harContent{Size: 11, MimeType: "application/json", Text: `{"ok`, Comment: "truncated"}, post.Response.Content)
+	assert.Equal(t, []harCookie{{Name: "sid", Value: "REDACTED", Path: "/", HTTPOnly: true}}, post.Response.Cookies)
+	assert.GreaterOrEqual(t, post.Timings["wait"], 0.0)
+	assert.Greater(t, post.Time, 0.0)
+
+	redirect, final := doc.Log.Entries[1], doc.Log.Entries[2]
+	assert.Equal(t, http.StatusFound, redirect.Response.Status)
+	assert.Equal(t, "/new?page=2", redirect.Response.RedirectURL)
+	assert.Equal(t, srv.URL+"/new?page=2", final.Request.URL)
+	assert.Equal(t, http.StatusOK, final.Response.Status)
+}
+
+type countingTransport struct {
+	n atomic.Int32
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.n.Add(1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestWithTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	rt := &countingTransport{}
+	s := NewSession(WithTransport(rt))
+	for range 2 {
+		_, err := s.Get(context.Background(), srv.URL)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, int32(2), rt.n.Load())
+
+	_, err := s.Get(context.Background(), srv.URL, WithProxy(srv.URL))
+	assert.ErrorIs(t, err, ErrRequest)
+}
+
+func TestWithTransportClonedForProxy(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.URL.String())
+	}))
+	defer srv.Close()
+
+	base := &http.Transport{}
+	resp, err := Get(context.Background(), "http://upstream.test/x", WithTransport(base), WithProxy(srv.URL))
+	assert.NoError(t, err)
+	text, _ := resp.Text()
+	assert.Equal(t, "http://upstream.test/x", text)
+	assert.Nil(t, base.Proxy)
+}
+
+func TestSessionSharesTransport(t *testing.T) {
+	var opened, closed atomic.Int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		switch state {
+		case http.StateNew:
+			opened.Add(1)
+		case http.StateClosed:
+			closed.Add(1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	var dials atomic.Int32
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dials.Add(1)
+		var d net.Dialer
+		return d.DialContext(ctx, network, addr)
+	}
+	base := &http.Transport{}
+	s := NewSession(WithTransport(base), WithDialContext(dial))
+	for range 5 {
+		resp, err := s.Get(context.Background(), srv.URL, WithHeader("X-Req", "1"))
+		assert.NoError(t, err)
+		_, _ = resp.Bytes()
+	}
+	assert.Equal(t, int32(1), dials.Load())
+	assert.Equal(t, int32(1), opened.Load())
+	assert.Nil(t, base.DialContext)
+
+	// Transport options added per request get their own transport, which keeps no idle connections.
+	for range 3 {
+		resp, err := s.Get(context.Background(), srv.URL, WithResolve("x.test:80", "127.0.0.1"))
+		assert.NoError(t, err)
+		_, _ = resp.Bytes()
+	}
+	assert.Equal(t, int32(4), dials.Load())
+	assert.Eventually(t, func() bool { return closed.Load() == 3 }, time.Second, 10*time.Millisecond)
+}
+
+func TestWithHTTPClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := r.Cookie("sid"); err != nil {
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: "1"})
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	jar, err := cookiejar.New(nil)
+	assert.NoError(t, err)
+	client := &http.Client{Jar: jar}
+	s := NewSession(WithHTTPClient(client))
+
+	_, err = s.Get(context.Background(), srv.URL)
+	assert.ErrorIs(t, err, ErrStatus)
+	_, err = s.Get(context.Background(), srv.URL)
+	assert.NoError(t, err)
+
+	_, err = s.Get(context.Background(), srv.URL, WithTimeout(10*time.Millisecond))
+	assert.ErrorIs(t, err, ErrTimeout)
+	assert.Zero(t, client.Timeout)
+}
+
+func TestWithUnixSocket(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "d.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Skip("unix sockets unavailable:", err)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Host+r.URL.Path)
+	}))
+	srv.Listener = l
+	srv.Start()
+	defer srv.Close()
+
+	resp, err := Get(context.Background(), "http://docker/containers/json", WithUnixSocket(sock))
+	assert.NoError(t, err)
+	text, _ := resp.Text()
+	assert.Equal(t, "docker/containers/json", text)
+
+	cmd, err := NewRequest(http.MethodGet, "http://docker/info", WithUnixSocket(sock)).ToCurl()
+	assert.NoError(t, err)
+	assert.Equal(t, "curl http://docker/info --unix-socket "+sock+" -L", cmd)
+
+	method, rawURL, opts, err := FromCurl(cmd)
+	assert.NoError(t, err)
+	resp, err = Do(context.Background(), method, rawURL, opts...)
+	assert.NoError(t, err)
+	text, _ = resp.Text()
+	assert.Equal(t, "docker/info", text)
+}
+
+func TestWithDialContextAndTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Host)
+	}))
+	defer srv.Close()
+
+	var dialed []string
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed = append(dialed, addr)
+		var d net.Dialer
+		return d.DialContext(ctx, network, srv.Listener.Addr().String())
+	}
+	resp, err := Get(context.Background(), "https://api.internal:8443/", WithDialContext(dial), WithInsecureSkipVerify())
+	assert.NoError(t, err)
+	text, _ := resp.Text()
+	assert.Equal(t, "api.internal:8443", text)
+	assert.Equal(t, []string{"api.internal:8443"}, dialed)
+}
+
+type staticResolver struct {
+	addrs []string
+	calls atomic.Int32
+}
+
+func (r *staticResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	r.calls.Add(1)
+	if host != "api.test" {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return r.addrs, nil
+}
+
+func TestWithResolve(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Host)
+	}))
+	defer srv.Close()
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+
+	resp, err := Get(context.Background(), "http://blue.test:"+port+"/", WithResolve("blue.test:"+port, "127.0.0.1"))
+	assert.NoError(t, err)
+	text, _ := resp.Text()
+	assert.Equal(t, "blue.test:"+port, text)
+
+	resp, err = Get(context.Background(), "http://green.test/", WithResolve("green.test:80", srv.Listener.Addr().String()))
+	assert.NoError(t, err)
+	text, _ = resp.Text()
+	assert.Equal(t, "green.test", text)
+
+	_, err = Get(context.Background(), "http://x.test/", WithResolve("x.test", "127.0.0.1"))
+	assert.ErrorIs(t, err, ErrRequest)
+
+	cmd, err := NewRequest(http.MethodGet, "http://green.test/",
+		WithResolve("green.test:80", srv.Listener.Addr().String()),
+		WithResolve("blue.test:"+port, "::1"),
+	).ToCurl()
+	assert.NoError(t, err)
+	assert.Contains(t, cmd, "--connect-to green.test:80:"+srv.Listener.Addr().String())
+	assert.Contains(t, cmd, "--resolve 'blue.test:"+port+":[::1]'")
+
+	method, rawURL, opts, err := FromCurl("curl --resolve blue.test:" + port + ":127.0.0.1 http://blue.test:" + port + "/")
+	assert.NoError(t, err)
+	_, err = Do(context.Background(), method, rawURL, opts...)
+	assert.NoError(t, err)
+}
+
+func TestWithResolverAndDNSCache(t *testing.T) {
+	var conns atomic.Int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+
+	// The first address refuses connections, so every request falls through to the second.
+	res := &staticResolver{addrs: []string{"127.0.0.2", "127.0.0.1"}}
+	if ln, err := net.Listen("tcp", "127.0.0.2:0"); err != nil {
+		res.addrs = res.addrs[1:]
+	} else {
+		_ = ln.Close()
+	}
+	cache := NewDNSCache(res, time.Minute)
+	s := NewSession(WithResolver(cache))
+	for range 3 {
+		_, err := s.Get(context.Background(), "http://api.test:"+port+"/")
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, int32(1), res.calls.Load())
+	assert.Equal(t, int32(1), conns.Load(), "session requests share one connection")
+
+	_, err := s.Get(context.Background(), "http://other.test:"+port+"/")
+	assert.ErrorIs(t, err, ErrNetwork)
+
+	cache.Flush()
+	_, err = cache.LookupHost(context.Background(), "api.test")
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), res.calls.Load())
+}
+
+func TestDNSCacheRoundRobin(t *testing.T) {
+	res := &staticResolver{addrs: []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}}
+	cache := NewDNSCache(res, time.Minute)
+	var firsts []string
+	for range 4 {
+		addrs, err := cache.LookupHost(context.Background(), "api.test")
+		assert.NoError(t, err)
+		assert.Len(t, addrs, 3)
+		firsts = append(firsts, addrs[0])
+	}
+	assert.Equal(t, []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.1"}, firsts)
+	assert.Equal(t, int32(1), res.calls.Load())
+
+	expiring := NewDNSCache(res, time.Nanosecond)
+	_, _ = expiring.LookupHost(context.Background(), "api.test")
+	time.Sleep(time.Millisecond)
+	_, _ = expiring.LookupHost(context.Background(), "api.test")
+	assert.Equal(t, int32(3), res.calls.Load())
+}
+
+// startSOCKS5 runs a minimal SOCKS5 server that requires user/pass and reports the requested targets.
+func startSOCKS5(t *testing.T, user, pass string) (string, <-chan string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	targets := make(chan string, 16)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				buf := make([]byte, 512)
+				// Greeting: require username/password authentication.
+				if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+					return
+				}
+				_, _ = io.ReadFull(conn, buf[:buf[1]])
+				_, _ = conn.Write([]byte{5, 2})
+				_, _ = io.ReadFull(conn, buf[:2])
+				u := make([]byte, buf[1])
+				_, _ = io.ReadFull(conn, u)
+				_, _ = io.ReadFull(conn, buf[:1])
+				p := make([]byte, buf[0])
+				_, _ = io.ReadFull(conn, p)
+				if string(u) != user || string(p) != pass {
+					_, _ = conn.Write([]byte{1, 1})
+					return
+				}
+				_, _ = conn.Write([]byte{1, 0})
+				// CONNECT request.
+				_, _ = io.ReadFull(conn, buf[:4])
+				var host string
+				switch buf[3] {
+				case 1:
+					_, _ = io.ReadFull(conn, buf[:4])
+					host = net.IP(buf[:4]).String()
+				case 3:
+					_, _ = io.ReadFull(conn, buf[:1])
+					name := make([]byte, buf[0])
+					_, _ = io.ReadFull(conn, name)
+					host = string(name)
+				default:
+					return
+				}
+				_, _ = io.ReadFull(conn, buf[:2])
+				target := net.JoinHostPort(host, strconv.Itoa(int(buf[0])<<8|int(buf[1])))
+				targets <- target
+				if host == "upstream.test" {
+					target = "127.0.0.1" + target[len(host):]
+				}
+				up, err := net.Dial("tcp", target)
+				if err != nil {
+					_, _ = conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+					return
+				}
+				defer up.Close()
+				_, _ = conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+				go func() { _, _ = io.Copy(up, conn) }()
+				_, _ = io.Copy(conn, up)
+			}()
+		}
+	}()
+	return ln.Addr().String(), targets
+}
+
+func TestWithSOCKS5Proxy(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "via socks")
+	}))
+	defer srv.Close()
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	addr, targets := startSOCKS5(t, "alice", "s3cret")
+
+	resp, err := Get(context.Background(), "http://upstream.test:"+port+"/", WithProxy("socks5h://alice:s3cret@"+addr))
+	assert.NoError(t, err)
+	text, _ := resp.Text()
+	assert.Equal(t, "via socks", text)
+	assert.Equal(t, "upstream.test:"+port, <-targets)
+
+	// socks5 resolves the host locally and asks the proxy for the address.
+	res := &staticResolver{addrs: []string{"127.0.0.1"}}
+	resp, err = Get(context.Background(), "http://api.test:"+port+"/", WithProxy("socks5://alice:s3cret@"+addr), WithResolver(res))
+	assert.NoError(t, err)
+	text, _ = resp.Text()
+	assert.Equal(t, "via socks", text)
+	assert.Equal(t, "127.0.0.1:"+port, <-targets)
+	assert.Equal(t, int32(1), res.calls.Load())
+
+	session := NewSession(WithProxy(addr))
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Go(func() {
+			_, _ = session.Get(context.Background(), srv.URL, WithProxy("socks5h://alice:s3cret@"+addr))
+		})
+	}
+	wg.Wait()
+	for range 8 {
+		<-targets
+	}
+
+	_, err = Get(context.Background(), srv.URL, WithProxy("socks5://alice:wrong@"+addr))
+	assert.ErrorIs(t, err, ErrNetwork)
+
+	_, err = Get(context.Background(), srv.URL, WithProxy("ftp://"+addr))
+	assert.ErrorIs(t, err, ErrRequest)
+}
+
+func TestWithProxyConnectHeader(t *testing.T) {
+	target := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "tunneled")
+	}))
+	defer target.Close()
+
+	var auth, token string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			http.Error(w, "CONNECT only", http.StatusMethodNotAllowed)
+			return
+		}
+		auth, token = r.Header.Get("Proxy-Authorization"), r.Header.Get("X-Proxy-Token")
+		up, err := net.Dial("tcp", target.Listener.Addr().String())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		conn, _, _ := http.NewResponseController(w).Hijack()
+		go func() { _, _ = io.Copy(up, conn) }()
+		_, _ = io.Copy(conn, up)
+		_ = conn.Close()
+		_ = up.Close()
+	}))
+	defer proxy.Close()
+
+	resp, err := Get(context.Background(), target.URL,
+		WithProxy(strings.Replace(proxy.URL, "http://", "http://bob:pw@", 1)),
+		WithProxyConnectHeader("X-Proxy-Token", "t1"),
+		WithInsecureSkipVerify(),
+	)
+	assert.NoError(t, err)
+	text, _ := resp.Text()
+	assert.Equal(t, "tunneled", text)
+	assert.Equal(t, "Basic Ym9iOnB3", auth)
+	assert.Equal(t, "t1", token)
+}
+
+func TestWithProxyFromEnvironment(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "proxied "+r.URL.String())
+	}))
+	defer proxy.Close()
+	direct := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "direct")
+	}))
+	defer direct.Close()
+
+	for _, k := range []string{"HTTP_PROXY", "http_proxy", "HTTPS_PROXY", "https_proxy", "NO_PROXY", "no_proxy", "REQUEST_METHOD"} {
+		t.Setenv(k, "")
+	}
+	t.Setenv("HTTP_PROXY", proxy.URL)
+	t.Setenv("NO_PROXY", "internal.test")
+	s := NewSession(WithProxyFromEnvironment(), WithResolve("internal.test:80", direct.Listener.Addr().String()))
+
+	resp, err := s.Get(context.Background(), "http://public.test/a")
+	assert.NoError(t, err)
+	text, _ := resp.Text()
+	assert.Equal(t, "proxied http://public.test/a", text)
+
+	resp, err = s.Get(context.Background(), "http://internal.test/b")
+	assert.NoError(t, err)
+	text, _ = resp.Text()
+	assert.Equal(t, "direct", text)
+
+	resp, err = s.Get(context.Background(), "http://public.test/c", WithProxyFunc(func(*http.Request) (*url.URL, error) {
+		return nil, nil
+	}), WithResolve("public.test:80", direct.Listener.Addr().String()))
+	assert.NoError(t, err)
+	text, _ = resp.Text()
+	assert.Equal(t, "direct", text)
+}
+
+func TestHTTP2Options(t *testing.T) {
+	var conns atomic.Int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Proto)
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	resp, err := Get(context.Background(), srv.URL, WithInsecureSkipVerify(), WithHTTP2(),
+		WithHTTP2Config(http.HTTP2Config{SendPingTimeout: time.Second, PingTimeout: time.Second}))
+	assert.NoError(t, err)
+	assert.Equal(t, "HTTP/2.0", resp.Proto)
+	text, _ := resp.Text()
+	assert.Equal(t, "HTTP/2.0", text)
+
+	resp, err = Get(context.Background(), srv.URL, WithInsecureSkipVerify(), WithHTTP1Only())
+	assert.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1", resp.Proto)
+
+	// Session requests share one health-checked HTTP/2 connection.
+	conns.Store(0)
+	s := NewSession(WithInsecureSkipVerify(), WithHTTP2(),
+		WithHTTP2Config(http.HTTP2Config{SendPingTimeout: time.Second, PingTimeout: time.Second}))
+	for range 3 {
+		resp, err = s.Get(context.Background(), srv.URL)
+		assert.NoError(t, err)
+		_, _ = resp.Bytes()
+	}
+	assert.Equal(t, int32(1), conns.Load())
+}
+
+func TestWithH2C(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Proto)
+	}))
+	srv.Config.Protocols = new(http.Protocols)
+	srv.Config.Protocols.SetHTTP1(true)
+	srv.Config.Protocols.SetUnencryptedHTTP2(true)
+	srv.Start()
+	defer srv.Close()
+
+	resp, err := Get(context.Background(), srv.URL, WithH2C())
+	assert.NoError(t, err)
+	assert.Equal(t, "HTTP/2.0", resp.Proto)
+
+	cmd, err := NewRequest(http.MethodGet, srv.URL, WithH2C()).ToCurl()
+	assert.NoError(t, err)
+	assert.Contains(t, cmd, "--http2-prior-knowledge")
+	method, rawURL, opts, err := FromCurl(cmd)
+	assert.NoError(t, err)
+	resp, err = Do(context.Background(), method, rawURL, opts...)
+	assert.NoError(t, err)
+	assert.Equal(t, "HTTP/2.0", resp.Proto)
+
+	resp, err = Get(context.Background(), srv.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, "HTTP/1.1", resp.Proto)
+}
+
+func TestRedirectPolicy(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Header.Get("X-Api-Key")+"|"+r.Header.Get("X-Trace"))
+	}))
+	defer other.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/away":
+			http.Redirect(w, r, other.URL+"/landing", http.StatusFound)
+		case "/ftp":
+			http.Redirect(w, r, "ftp://files.example.com/x", http.StatusFound)
+		case "/moved":
+			http.Redirect(w, r, "/echo", http.StatusMovedPermanently)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		case "/echo":
+			b, _ := io.ReadAll(r.Body)
+			_, _ = io.WriteString(w, r.Method+" "+r.Header.Get("Content-Type")+" "+string(b))
+		}
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	resp, err := Get(ctx, srv.URL+"/away", WithRedirectPolicy(RedirectPolicy{}),
+		WithHeader("X-Api-Key", "k"), WithHeader("X-Trace", "t"))
+	assert.NoError(t, err)
+	text, _ := resp.Text()
+	assert.Equal(t, "|t", text)
+	if assert.Len(t, resp.History, 1) {
+		assert.Equal(t, http.StatusFound, resp.History[0].StatusCode)
+		assert.Equal(t, other.URL+"/landing", resp.History[0].Headers.Get("Location"))
+	}
+
+	_, err = Get(ctx, srv.URL+"/away", WithRedirectPolicy(RedirectPolicy{SameHost: true}))
+	assert.ErrorIs(t, err, ErrRedirect)
+	_, err = Get(ctx, srv.URL+"/ftp", WithRedirectPolicy(RedirectPolicy{}))
+	assert.ErrorIs(t, err, ErrRedirect)
+	_, err = Get(ctx, srv.URL+"/loop", WithRedirectPolicy(RedirectPolicy{MaxHops: 3}))
+	assert.ErrorIs(t, err, ErrRedirect)
+	assert.ErrorContains(t, err, "stopped after 3 redirects")
+
+	resp, err = Get(ctx, srv.URL+"/loop", WithRedirectPolicy(RedirectPolicy{MaxHops: -1}), WithNoStatusError())
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+
+	resp, err = Post(ctx, srv.URL+"/moved", WithJSON(map[string]int{"a": 1}))
+	assert.NoError(t, err)
+	text, _ = resp.Text()
+	assert.Equal(t, "GET  ", text)
+
+	resp, err = Post(ctx, srv.URL+"/moved", WithJSON(map[string]int{"a": 1}), WithRedirectPolicy(RedirectPolicy{PreserveMethod: true}))
+	assert.NoError(t, err)
+	text, _ = resp.Text()
+	assert.Equal(t, `POST application/json {"a":1}`, text)
+
+	cmd, err := NewRequest(http.MethodPost, srv.URL, WithRedirectPolicy(RedirectPolicy{MaxHops: 2, PreserveMethod: true, AllowedSchemes: []string{"https"}})).ToCurl()
+	assert.NoError(t, err)
+	assert.Contains(t, cmd, "-L --max-redirs 2 --post301 --post302 --proto-redir =https")
+
+	session := NewSession(WithRedirectPolicy(RedirectPolicy{StripHeaders: []string{"X-Trace"}}))
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Go(func() {
+			resp, err := session.Get(ctx, srv.URL+"/away", WithHeader("X-Trace", "t"))
+			if assert.NoError(t, err) {
+				text, _ := resp.Text()
+				assert.Equal(t, "|", text)
+			}
+		})
+	}
+	wg.Wait()
+}
+
+func TestRedirectPolicyRejectsDowngrade(t *testing.T) {
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer plain.Close()
+	secure := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, plain.URL, http.StatusFound)
+	}))
+	defer secure.Close()
+
+	_, err := Get(context.Background(), secure.URL, WithInsecureSkipVerify(), WithRedirectPolicy(RedirectPolicy{}))
+	assert.ErrorIs(t, err, ErrRedirect)
+
+	_, err = Get(context.Background(), secure.URL, WithInsecureSkipVerify(), WithRedirectPolicy(RedirectPolicy{AllowDowngrade: true}))
+	assert.NoError(t, err)
+}
+
+func TestResponseURLAndRequest(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/start" {
+			http.Redirect(w, r, "/final?page=2", http.StatusFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	resp, err := Get(context.Background(), srv.URL+"/start?token=abc",
+		WithHeader("Authorization", "Bearer secret"), WithHeader("X-Trace", "t"))
+	assert.NoError(t, err)
+	assert.Equal(t, srv.URL+"/final?page=2", resp.URL.String())
+	assert.Equal(t, "HTTP/1.1", resp.Proto)
+	assert.Positive(t, resp.Elapsed)
+	if assert.NotNil(t, resp.Request) {
+		assert.Equal(t, http.MethodGet, resp.Request.Method)
+		assert.Equal(t, srv.URL+"/final?page=2", resp.Request.URL)
+		assert.Equal(t, "REDACTED", resp.Request.Headers.Get("Authorization"))
+		assert.Equal(t, "t", resp.Request.Headers.Get("X-Trace"))
+	}
+	if assert.Len(t, resp.History, 1) {
+		hop := resp.History[0]
+		assert.Equal(t, http.StatusFound, hop.StatusCode)
+		assert.Equal(t, "/start", hop.URL.Path)
+		assert.Equal(t, srv.URL+"/start?token=REDACTED", hop.Request.URL)
+		assert.Zero(t, hop.Elapsed)
+	}
+}
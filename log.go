@@ -0,0 +1,210 @@
+package requests
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const redacted = "REDACTED"
+
+// LogOption configures WithLogger.
+type LogOption func(*logConfig)
+
+type logConfig struct {
+	logger     *slog.Logger
+	level      slog.Level
+	errorLevel slog.Level
+	redact     []string
+	maxBody    int
+}
+
+// WithLogger emits structured records to l for request start, response and transport errors.
+// Records are logged at Debug and failures (errors and rejected statuses) at Error by default.
+// Sensitive headers and query parameters are redacted and bodies are not logged unless LogBodies is set.
+func WithLogger(l *slog.Logger, opts ...LogOption) Option {
+	cfg := &logConfig{logger: l, level: slog.LevelDebug, errorLevel: slog.LevelError}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(cfg)
+		}
+	}
+	return func(r *Request) {
+		r.log = cfg
+	}
+}
+
+// LogLevel sets the level for request and successful response records.
+func LogLevel(level slog.Level) LogOption {
+	return func(c *logConfig) {
+		c.level = level
+	}
+}
+
+// LogErrorLevel sets the level for transport errors and rejected statuses.
+func LogErrorLevel(level slog.Level) LogOption {
+	return func(c *logConfig) {
+		c.errorLevel = level
+	}
+}
+
+// LogRedactHeaders adds header names whose values are redacted, on top of the defaults
+// (Authorization, Cookie and names containing token, secret, password or api key).
+func LogRedactHeaders(names ...string) LogOption {
+	return func(c *logConfig) {
+		c.redact = append(c.redact, names...)
+	}
+}
+
+// LogBodies logs request and response bodies up to max bytes. Only textual content types are logged.
+// Bodies are captured as they are read, so streaming bodies are not buffered: the response record
+// is logged once its body has been read to EOF or closed, and so is the request record for request
+// bodies that cannot be replayed.
+func LogBodies(max int) LogOption {
+	return func(c *logConfig) {
+		c.maxBody = max
+	}
+}
+
+// logRequest logs req. When its body is logged and cannot be replayed, the body is captured
+// as the transport sends it and the record is logged once it has been sent.
+func (c *logConfig) logRequest(ctx context.Context, req *http.Request) {
+	attrs := []slog.Attr{
+		slog.String("method", req.Method),
+		slog.String("url", redactURL(req.URL)),
+		slog.Any("headers", redactHeaders(req.Header, c.redact)),
+	}
+	if c.maxBody <= 0 || req.Body == nil || req.Body == http.NoBody || !isTextual(req.Header.Get("Content-Type")) {
+		c.logger.LogAttrs(ctx, c.level, "http request", attrs...)
+		return
+	}
+	if req.GetBody != nil {
+		if rc, err := req.GetBody(); err == nil {
+			b, _ := io.ReadAll(io.LimitReader(rc, int64(c.maxBody)+1))
+			_ = rc.Close()
+			attrs = append(attrs, slog.String("body", truncate(b, c.maxBody)))
+		}
+		c.logger.LogAttrs(ctx, c.level, "http request", attrs...)
+		return
+	}
+	req.Body = &capture{ReadCloser: req.Body, max: c.maxBody, done: func(body *capture) {
+		attrs = append(attrs, slog.String("body", body.String()))
+		c.logger.LogAttrs(ctx, c.level, "http request", attrs...)
+	}}
+}
+
+// logResponse logs resp. When its body is logged, the body is captured as it is read and the
+// record is logged once it reaches EOF or is closed.
+func (c *logConfig) logResponse(ctx context.Context, req *http.Request, resp *Response, ok bool, elapsed time.Duration) {
+	attrs := []slog.Attr{
+		slog.String("method", req.Method),
+		slog.String("url", redactURL(req.URL)),
+		slog.Int("status", resp.StatusCode),
+		slog.Duration("duration", elapsed),
+		slog.Any("headers", redactHeaders(resp.Headers, c.redact)),
+	}
+	level := c.level
+	if !ok {
+		level = c.errorLevel
+	}
+	if c.maxBody <= 0 || resp.Raw.Body == nil || !isTextual(resp.Headers.Get("Content-Type")) {
+		attrs = append(attrs, slog.Int64("bytes", resp.Raw.ContentLength))
+		c.logger.LogAttrs(ctx, level, "http response", attrs...)
+		return
+	}
+	resp.Raw.Body = &capture{ReadCloser: resp.Raw.Body, max: c.maxBody, done: func(body *capture) {
+		attrs = append(attrs, slog.String("body", body.String()), slog.Int64("bytes", body.n))
+		c.logger.LogAttrs(ctx, level, "http response", attrs...)
+	}}
+}
+
+func (c *logConfig) logError(ctx context.Context, req *http.Request, err error, elapsed time.Duration) {
+	c.logger.LogAttrs(ctx, c.errorLevel, "http request failed",
+		slog.String("method", req.Method),
+		slog.String("url", redactURL(req.URL)),
+		slog.Duration("duration", elapsed),
+		slog.String("error", err.Error()),
+	)
+}
+
+// isSensitiveName reports whether a header or query parameter name likely carries a secret.
+func isSensitiveName(name string, extra []string) bool {
+	n := strings.ToLower(name)
+	switch n {
+	case "authorization", "proxy-authorization", "cookie", "set-cookie", "key":
+		return true
+	}
+	for _, s := range []string{"token", "secret", "password", "signature", "api-key", "api_key", "apikey"} {
+		if strings.Contains(n, s) {
+			return true
+		}
+	}
+	for _, e := range extra {
+		if strings.EqualFold(name, e) {
+			return true
+		}
+	}
+	return false
+}
+
+func redactHeaders(h http.Header, extra []string) http.Header {
+	out := make(http.Header, len(h))
+	for k, vals := range h {
+		if isSensitiveName(k, extra) {
+			out[k] = []string{redacted}
+			continue
+		}
+		out[k] = vals
+	}
+	return out
+}
+
+// redactURL hides the userinfo password and sensitive query parameters.
+func redactURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	if u.RawQuery == "" {
+		return u.Redacted()
+	}
+	c := *u
+	q := c.Query()
+	changed := false
+	for k := range q {
+		if isSensitiveName(k, nil) {
+			q[k] = []string{redacted}
+			changed = true
+		}
+	}
+	if changed {
+		c.RawQuery = q.Encode()
+	}
+	return c.Redacted()
+}
+
+func isTextual(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	if strings.HasPrefix(mediaType, "text/") {
+		return true
+	}
+	switch mediaType {
+	case "application/json", "application/xml", "application/x-www-form-urlencoded", "application/javascript":
+		return true
+	}
+	return strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml")
+}
+
+func truncate(b []byte, max int) string {
+	if len(b) <= max {
+		return string(b)
+	}
+	return string(b[:max]) + "..."
+}
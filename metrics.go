@@ -0,0 +1,228 @@
+package requests
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics receives request lifecycle events. Implementations must be safe for concurrent use.
+type Metrics interface {
+	// RequestStarted is called before a request is sent.
+	RequestStarted(method, host string)
+	// RequestFinished is called once response headers arrive or the request fails.
+	RequestFinished(m RequestMetrics)
+}
+
+// RequestMetrics describes a finished request.
+type RequestMetrics struct {
+	Method string
+	Host   string
+	// StatusCode is zero when the request failed before a response arrived.
+	StatusCode int
+	Err        error
+	Duration   time.Duration
+	// ConnReused reports whether the last connection came from the idle pool.
+	ConnReused bool
+}
+
+// WithMetrics reports request events to m. Register it on a Session to cover all its requests.
+func WithMetrics(m Metrics) Option {
+	return func(r *Request) {
+		r.metrics = m
+	}
+}
+
+// DefaultBuckets are the latency histogram buckets, in seconds, used by NewMetricsCollector.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// MetricsCollector is a Metrics implementation that aggregates counters per method,
+// host and status class, latency histograms, in-flight gauges and connection reuse.
+// It renders the Prometheus text exposition format via WriteTo and ServeHTTP.
+type MetricsCollector struct {
+	buckets []float64
+
+	mu        sync.Mutex
+	requests  map[requestKey]uint64
+	durations map[hostKey]*histogram
+	inFlight  map[hostKey]int64
+	conns     map[connKey]uint64
+}
+
+type hostKey struct {
+	method string
+	host   string
+}
+
+type requestKey struct {
+	hostKey
+	class string
+}
+
+type connKey struct {
+	host   string
+	reused bool
+}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// NewMetricsCollector creates a collector with the given latency buckets in seconds.
+// DefaultBuckets are used when none are given.
+func NewMetricsCollector(buckets ...float64) *MetricsCollector {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	b := slices.Clone(buckets)
+	slices.Sort(b)
+	return &MetricsCollector{
+		buckets:   b,
+		requests:  make(map[requestKey]uint64),
+		durations: make(map[hostKey]*histogram),
+		inFlight:  make(map[hostKey]int64),
+		conns:     make(map[connKey]uint64),
+	}
+}
+
+func (c *MetricsCollector) RequestStarted(method, host string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inFlight[hostKey{method, host}]++
+}
+
+func (c *MetricsCollector) RequestFinished(m RequestMetrics) {
+	key := hostKey{m.Method, m.Host}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inFlight[key]--
+	c.requests[requestKey{key, statusClass(m.StatusCode)}]++
+
+	h := c.durations[key]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(c.buckets))}
+		c.durations[key] = h
+	}
+	secs := m.Duration.Seconds()
+	for i, le := range c.buckets {
+		if secs <= le {
+			h.counts[i]++
+		}
+	}
+	h.sum += secs
+	h.count++
+
+	if m.StatusCode != 0 {
+		c.conns[connKey{m.Host, m.ConnReused}]++
+	}
+}
+
+// WriteTo writes the collected metrics in the Prometheus text exposition format.
+func (c *MetricsCollector) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	c.mu.Lock()
+	c.write(cw)
+	c.mu.Unlock()
+	if cw.err == nil {
+		cw.err = cw.w.Flush()
+	}
+	return cw.n, cw.err
+}
+
+// ServeHTTP serves the metrics for scraping.
+func (c *MetricsCollector) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = c.WriteTo(w)
+}
+
+func (c *MetricsCollector) write(w *countingWriter) {
+	w.printf("# HELP http_client_requests_total Total HTTP client requests by status class.\n")
+	w.printf("# TYPE http_client_requests_total counter\n")
+	reqKeys := sortedKeys(c.requests, func(a, b requestKey) int {
+		return cmp.Or(compareHostKey(a.hostKey, b.hostKey), strings.Compare(a.class, b.class))
+	})
+	for _, k := range reqKeys {
+		w.printf("http_client_requests_total{method=%q,host=%q,status=%q} %d\n", k.method, k.host, k.class, c.requests[k])
+	}
+
+	w.printf("# HELP http_client_request_duration_seconds HTTP client request latency until response headers.\n")
+	w.printf("# TYPE http_client_request_duration_seconds histogram\n")
+	for _, k := range sortedKeys(c.durations, compareHostKey) {
+		h := c.durations[k]
+		labels := fmt.Sprintf("method=%q,host=%q", k.method, k.host)
+		for i, le := range c.buckets {
+			w.printf("http_client_request_duration_seconds_bucket{%s,le=%q} %d\n", labels, formatFloat(le), h.counts[i])
+		}
+		w.printf("http_client_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, h.count)
+		w.printf("http_client_request_duration_seconds_sum{%s} %s\n", labels, formatFloat(h.sum))
+		w.printf("http_client_request_duration_seconds_count{%s} %d\n", labels, h.count)
+	}
+
+	w.printf("# HELP http_client_requests_in_flight HTTP client requests currently in flight.\n")
+	w.printf("# TYPE http_client_requests_in_flight gauge\n")
+	for _, k := range sortedKeys(c.inFlight, compareHostKey) {
+		w.printf("http_client_requests_in_flight{method=%q,host=%q} %d\n", k.method, k.host, c.inFlight[k])
+	}
+
+	w.printf("# HELP http_client_connections_total HTTP client connections used, by whether they were reused from the pool.\n")
+	w.printf("# TYPE http_client_connections_total counter\n")
+	connKeys := sortedKeys(c.conns, func(a, b connKey) int {
+		return cmp.Or(strings.Compare(a.host, b.host), cmp.Compare(strconv.FormatBool(a.reused), strconv.FormatBool(b.reused)))
+	})
+	for _, k := range connKeys {
+		w.printf("http_client_connections_total{host=%q,reused=\"%t\"} %d\n", k.host, k.reused, c.conns[k])
+	}
+}
+
+func statusClass(code int) string {
+	if code == 0 {
+		return "error"
+	}
+	return strconv.Itoa(code/100) + "xx"
+}
+
+func compareHostKey(a, b hostKey) int {
+	return cmp.Or(strings.Compare(a.host, b.host), strings.Compare(a.method, b.method))
+}
+
+func sortedKeys[K comparable, V any](m map[K]V, cmp func(a, b K) int) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, cmp)
+	return keys
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// countingWriter remembers the first write error and the bytes written.
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) printf(format string, args ...any) {
+	if cw.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(cw.w, format, args...)
+	cw.n += int64(n)
+	cw.err = err
+}
@@ -0,0 +1,32 @@
+package requests
+
+import "net/http"
+
+// Middleware wraps the round tripper that sends a request.
+// It sees the request once per call, after options are applied, and the final
+// response after redirects have been followed.
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc adapts a function to http.RoundTripper.
+type RoundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip calls f(req).
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// WithMiddleware appends middlewares. The first middleware added is the outermost.
+func WithMiddleware(mw ...Middleware) Option {
+	return func(r *Request) {
+		r.middleware = append(r.middleware, mw...)
+	}
+}
+
+func chain(rt http.RoundTripper, mw []Middleware) http.RoundTripper {
+	for i := len(mw) - 1; i >= 0; i-- {
+		if mw[i] != nil {
+			rt = mw[i](rt)
+		}
+	}
+	return rt
+}
@@ -2,12 +2,19 @@ package requests
 
 import (
 	"bytes"
-	"encoding/json"
+	"context"
+	"crypto/tls"
+	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
+	"reflect"
+	"slices"
 	"strings"
 	"time"
+
+	"golang.org/x/net/http/httpproxy"
 )
 
 // Option mutates a Request.
@@ -35,6 +42,28 @@ func WithHeaders(h map[string]string) Option {
 	}
 }
 
+// withAddedHeader adds a value to a header, keeping the values already set.
+func withAddedHeader(key, value string) Option {
+	return func(r *Request) {
+		if r.headers == nil {
+			r.headers = make(http.Header)
+		}
+		r.headers.Add(key, value)
+	}
+}
+
+// withDefaultHeader sets a header only if it is not already present.
+func withDefaultHeader(key, value string) Option {
+	return func(r *Request) {
+		if r.headers == nil {
+			r.headers = make(http.Header)
+		}
+		if r.headers.Get(key) == "" {
+			r.headers.Set(key, value)
+		}
+	}
+}
+
 // WithQuery appends query parameters.
 func WithQuery(q map[string]string) Option {
 	return func(r *Request) {
@@ -47,41 +76,116 @@ func WithQuery(q map[string]string) Option {
 	}
 }
 
-// WithTimeout sets per-request timeout.
-func WithTimeout(d time.Duration) Option {
+// WithBaseURL resolves request URLs against base (RFC 3986).
+// Keep a trailing slash on base to resolve relative paths beneath it.
+func WithBaseURL(base string) Option {
 	return func(r *Request) {
-		r.timeout = d
+		if r.err != nil {
+			return
+		}
+		u, err := url.Parse(base)
+		if err != nil {
+			r.err = err
+			return
+		}
+		r.baseURL = u
 	}
 }
 
-// WithDecompressGzip enables gzip auto-decompression for response bodies.
-func WithDecompressGzip() Option {
+// WithPathParam sets a value for the {key} placeholder in the request URL.
+// The value is path-escaped before substitution; "." and ".." fail the request with ErrRequest.
+func WithPathParam(key, value string) Option {
 	return func(r *Request) {
-		r.decompressGzip = true
+		if r.pathParams == nil {
+			r.pathParams = make(map[string]string)
+		}
+		r.pathParams[key] = value
 	}
 }
 
-// WithJSON encodes v as JSON and sets Content-Type if missing.
-func WithJSON(v any) Option {
+// WithPathParams sets values for multiple {key} placeholders.
+func WithPathParams(params map[string]string) Option {
+	return func(r *Request) {
+		if r.pathParams == nil {
+			r.pathParams = make(map[string]string)
+		}
+		for k, v := range params {
+			r.pathParams[k] = v
+		}
+	}
+}
+
+// WithQueryStruct encodes a struct with `url` tags and appends it to the query.
+// Supported tags: `url:"name,omitempty"`, `url:",comma"` and `url:",brackets"` for slices,
+// `url:",unix"` / `url:",unixmilli"` or `layout:"2006-01-02"` for time.Time.
+func WithQueryStruct(v any) Option {
 	return func(r *Request) {
 		if r.err != nil {
 			return
 		}
-		b, err := json.Marshal(v)
+		values, err := encodeValues(v)
 		if err != nil {
 			r.err = err
 			return
 		}
-		r.body = bytes.NewReader(b)
-		if r.headers == nil {
-			r.headers = make(http.Header)
+		if r.query == nil {
+			r.query = make(url.Values)
 		}
-		if r.headers.Get("Content-Type") == "" {
-			r.headers.Set("Content-Type", "application/json")
+		for k, vals := range values {
+			r.query[k] = append(r.query[k], vals...)
 		}
 	}
 }
 
+// WithTimeout sets per-request timeout.
+func WithTimeout(d time.Duration) Option {
+	return func(r *Request) {
+		r.timeout = d
+	}
+}
+
+// WithTrace records connection and transfer timings, available via Response.Timings.
+func WithTrace() Option {
+	return func(r *Request) {
+		r.trace = true
+	}
+}
+
+// WithJSON encodes v with the codec registered for application/json and sets Content-Type if missing.
+func WithJSON(v any) Option {
+	return func(r *Request) {
+		if r.err != nil {
+			return
+		}
+		setCodecBody(r, jsonCodec(), v)
+	}
+}
+
+// WithBodyAs encodes v with codec and sets Content-Type if missing.
+func WithBodyAs(codec Codec, v any) Option {
+	return func(r *Request) {
+		if r.err != nil {
+			return
+		}
+		setCodecBody(r, codec, v)
+	}
+}
+
+func setCodecBody(r *Request, codec Codec, v any) {
+	b, err := codec.Marshal(v)
+	if err != nil {
+		r.err = err
+		return
+	}
+	r.body = bytes.NewReader(b)
+	if r.headers == nil {
+		r.headers = make(http.Header)
+	}
+	if r.headers.Get("Content-Type") == "" {
+		r.headers.Set("Content-Type", codec.ContentType())
+	}
+}
+
 // WithForm encodes form values and sets Content-Type.
 func WithForm(values map[string]string) Option {
 	return func(r *Request) {
@@ -92,16 +196,39 @@ func WithForm(values map[string]string) Option {
 		for k, v := range values {
 			form.Set(k, v)
 		}
-		r.body = strings.NewReader(form.Encode())
-		if r.headers == nil {
-			r.headers = make(http.Header)
+		setForm(r, form)
+	}
+}
+
+// WithFormStruct encodes a struct with `url` tags as the form body and sets Content-Type.
+// Tags follow the same rules as WithQueryStruct.
+func WithFormStruct(v any) Option {
+	return func(r *Request) {
+		if r.err != nil {
+			return
+		}
+		form, err := encodeValues(v)
+		if err != nil {
+			r.err = err
+			return
 		}
-		r.headers.Set("Content-Type", "application/x-www-form-urlencoded")
+		setForm(r, form)
 	}
 }
 
+func setForm(r *Request, form url.Values) {
+	r.body = strings.NewReader(form.Encode())
+	if r.headers == nil {
+		r.headers = make(http.Header)
+	}
+	r.headers.Set("Content-Type", "application/x-www-form-urlencoded")
+}
+
 // WithBody sets a raw body reader.
-// Note: the reader is used as-is; do not reuse it across concurrent requests.
+// Only *bytes.Buffer, *bytes.Reader and *strings.Reader bodies can be replayed; they are copied
+// for each send. Other readers are used as-is and streamed without buffering, so they are sent
+// once, are not resent on 307/308 redirects and Response.CurlCommand omits them; do not reuse
+// them across requests, and read the data into a []byte and pass bytes.NewReader to keep it.
 func WithBody(body io.Reader) Option {
 	return func(r *Request) {
 		r.body = body
@@ -115,24 +242,236 @@ func WithCookies(cookies ...*http.Cookie) Option {
 	}
 }
 
-// WithProxy sets a proxy URL for the request.
+// WithProxy sets a proxy URL for the request. The scheme may be http, https, socks5 or
+// socks5h and defaults to http. With socks5 host names are resolved locally, using
+// WithResolver when set; socks5h sends them to the proxy to resolve. Credentials in the
+// URL are sent as Proxy-Authorization to HTTP proxies, including for HTTPS CONNECT, and as
+// SOCKS5 username/password authentication.
 func WithProxy(rawURL string) Option {
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err == nil {
+		switch u.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			err = fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+		}
+	}
 	return func(r *Request) {
 		if r.err != nil {
 			return
 		}
-		u, err := url.Parse(rawURL)
 		if err != nil {
 			r.err = err
 			return
 		}
 		r.proxy = u
+		r.proxyFunc = nil
+		r.transportChanged = true
+	}
+}
+
+// WithProxyFunc selects the proxy per request, like http.Transport.Proxy.
+// A nil URL sends the request directly.
+func WithProxyFunc(fn func(*http.Request) (*url.URL, error)) Option {
+	return func(r *Request) {
+		r.proxyFunc = fn
+		r.proxy = nil
+		r.transportChanged = true
+	}
+}
+
+// WithProxyFromEnvironment uses the proxies from HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+// (or their lowercase forms), read when the option is created. Requests to localhost are not proxied.
+func WithProxyFromEnvironment() Option {
+	proxy := httpproxy.FromEnvironment().ProxyFunc()
+	return WithProxyFunc(func(req *http.Request) (*url.URL, error) {
+		return proxy(req.URL)
+	})
+}
+
+// WithProxyConnectHeader adds a header to CONNECT requests sent to HTTP proxies for HTTPS
+// targets, for example a Proxy-Authorization token other than Basic credentials.
+func WithProxyConnectHeader(key, value string) Option {
+	return func(r *Request) {
+		if r.proxyConnectHeader == nil {
+			r.proxyConnectHeader = make(http.Header)
+		}
+		r.proxyConnectHeader.Set(key, value)
+		r.transportChanged = true
+	}
+}
+
+// WithTLSConfig sets the TLS configuration. The config is cloned.
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(r *Request) {
+		r.tlsConfig = cfg.Clone()
+		r.transportChanged = true
+	}
+}
+
+// WithInsecureSkipVerify disables TLS certificate verification. Use only for testing.
+func WithInsecureSkipVerify() Option {
+	return func(r *Request) {
+		if r.tlsConfig == nil {
+			r.tlsConfig = &tls.Config{}
+		} else {
+			r.tlsConfig = r.tlsConfig.Clone()
+		}
+		r.tlsConfig.InsecureSkipVerify = true
+		r.transportChanged = true
+	}
+}
+
+// WithHTTP2 requires HTTP/2 for https:// requests; they fail when the server does not
+// negotiate it. Use WithH2C for HTTP/2 over plain http://.
+func WithHTTP2() Option {
+	return func(r *Request) {
+		r.protocols = new(http.Protocols)
+		r.protocols.SetHTTP2(true)
+		r.transportChanged = true
+	}
+}
+
+// WithHTTP1Only disables HTTP/2 so every request uses HTTP/1.1.
+func WithHTTP1Only() Option {
+	return func(r *Request) {
+		r.protocols = new(http.Protocols)
+		r.protocols.SetHTTP1(true)
+		r.transportChanged = true
+	}
+}
+
+// WithH2C sends http:// requests over cleartext HTTP/2 with prior knowledge (h2c), as used by
+// gRPC-style internal services. https:// requests use HTTP/2 over TLS.
+func WithH2C() Option {
+	return func(r *Request) {
+		r.protocols = new(http.Protocols)
+		r.protocols.SetUnencryptedHTTP2(true)
+		r.protocols.SetHTTP2(true)
+		r.transportChanged = true
+	}
+}
+
+// WithHTTP2Config tunes HTTP/2 connections. Set SendPingTimeout and PingTimeout to detect
+// dead connections with health check pings. Set it on a Session so that its requests share
+// the pooled connections being checked.
+func WithHTTP2Config(cfg http.HTTP2Config) Option {
+	return func(r *Request) {
+		r.http2Config = &cfg
+		r.transportChanged = true
 	}
 }
 
 // WithRedirect sets max redirects. max=0 disables redirects.
+// When the limit is reached the last 3xx response is returned.
 func WithRedirect(max int) Option {
 	return func(r *Request) {
 		r.redirectMax = &max
+		r.redirectPolicy = nil
+	}
+}
+
+// WithTransport sends the request through rt instead of http.DefaultTransport.
+// WithProxy and the TLS options require rt to be an *http.Transport, which is cloned before they are applied.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(r *Request) {
+		r.transport = rt
+		r.transportChanged = true
 	}
 }
+
+// WithDialContext sets the function used to open connections, for example to route through
+// a custom network or a different address. Proxy and TLS settings still apply on top of it.
+func WithDialContext(dial func(ctx context.Context, network, addr string) (net.Conn, error)) Option {
+	return func(r *Request) {
+		r.dial = dial
+		r.unixSocket = ""
+		r.transportChanged = true
+	}
+}
+
+// WithUnixSocket connects to the Unix domain socket at path instead of the URL host,
+// which is still sent in the Host header:
+//
+//	Get(ctx, "http://docker/containers/json", WithUnixSocket("/var/run/docker.sock"))
+func WithUnixSocket(path string) Option {
+	return func(r *Request) {
+		var d net.Dialer
+		r.dial = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return d.DialContext(ctx, "unix", path)
+		}
+		r.unixSocket = path
+		r.transportChanged = true
+	}
+}
+
+// WithHTTPClient sends the request with a copy of c, keeping its transport, cookie jar,
+// redirect policy and timeout. WithTransport, WithTimeout and WithRedirect override them.
+func WithHTTPClient(c *http.Client) Option {
+	return func(r *Request) {
+		r.httpClient = c
+		r.transportChanged = true
+	}
+}
+
+// WithErrorResult decodes non-2xx response bodies using Response.Decode into a new value of
+// the type v points to, and exposes it as StatusError.Result. v only selects the type and is not
+// modified, so the option is safe as a Session default. If the result implements error it can be
+// extracted with errors.As:
+//
+//	_, err := s.Post(ctx, "/users", requests.WithErrorResult(&APIError{}))
+//	var apiErr *APIError
+//	if errors.As(err, &apiErr) { ... }
+func WithErrorResult(v any) Option {
+	t := reflect.TypeOf(v)
+	return func(r *Request) {
+		if r.err != nil {
+			return
+		}
+		if t == nil || t.Kind() != reflect.Pointer {
+			r.err = fmt.Errorf("WithErrorResult needs a pointer, got %T", v)
+			return
+		}
+		r.errorDecoder = func(resp *Response) any {
+			out := reflect.New(t.Elem()).Interface()
+			if resp.Decode(out) != nil {
+				return nil
+			}
+			return out
+		}
+	}
+}
+
+// WithErrorDecoder sets a function that decodes non-2xx responses into StatusError.Result.
+// Returning nil leaves Result unset. It is safe to use as a Session default.
+func WithErrorDecoder(fn func(*Response) any) Option {
+	return func(r *Request) {
+		r.errorDecoder = fn
+	}
+}
+
+// WithOKStatus treats the given status codes as success in addition to 2xx.
+// It replaces any validator set earlier.
+func WithOKStatus(codes ...int) Option {
+	return func(r *Request) {
+		r.okStatus = func(code int) bool {
+			return (code >= 200 && code < 300) || slices.Contains(codes, code)
+		}
+	}
+}
+
+// WithStatusValidator sets the function deciding which status codes are success.
+// Other codes produce a *StatusError. It replaces any validator set earlier.
+func WithStatusValidator(fn func(int) bool) Option {
+	return func(r *Request) {
+		r.okStatus = fn
+	}
+}
+
+// WithNoStatusError treats every status code as success.
+func WithNoStatusError() Option {
+	return WithStatusValidator(func(int) bool { return true })
+}
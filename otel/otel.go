@@ -0,0 +1,209 @@
+// Package otel instruments go-requests with OpenTelemetry tracing and metrics.
+//
+// Install the middleware on a request or Session:
+//
+//	s := requests.NewSession(requests.WithMiddleware(reqotel.Middleware()))
+//
+// Each call through the middleware creates one client span following the HTTP
+// semantic conventions and injects the configured propagators (W3C traceparent and
+// baggage by default). The span is a child of the span in the request context.
+//
+// The middleware wraps the whole call, so redirects followed by the client are part
+// of the same span and every hop carries the same traceparent. Placed inside a retry
+// middleware it is called once per attempt and each attempt gets its own span; the
+// attempts are siblings under the span in the request context, so start a span
+// around the call to group them. Placed outside, all attempts share one span.
+package otel
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	requests "github.com/CareyWang/go-requests"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ScopeName is the instrumentation scope used for tracers and meters.
+const ScopeName = "github.com/CareyWang/go-requests/otel"
+
+// Option configures Middleware.
+type Option func(*config)
+
+type config struct {
+	tracerProvider trace.TracerProvider
+	meterProvider  metric.MeterProvider
+	propagators    propagation.TextMapPropagator
+}
+
+// WithTracerProvider sets the tracer provider. The global provider is used by default.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(c *config) {
+		c.tracerProvider = tp
+	}
+}
+
+// WithMeterProvider sets the meter provider. The global provider is used by default.
+func WithMeterProvider(mp metric.MeterProvider) Option {
+	return func(c *config) {
+		c.meterProvider = mp
+	}
+}
+
+// WithPropagators sets the propagators used to inject headers.
+// The default is W3C trace context and baggage.
+func WithPropagators(p propagation.TextMapPropagator) Option {
+	return func(c *config) {
+		c.propagators = p
+	}
+}
+
+type instruments struct {
+	tracer       trace.Tracer
+	propagators  propagation.TextMapPropagator
+	duration     metric.Float64Histogram
+	requestSize  metric.Int64Histogram
+	responseSize metric.Int64Histogram
+}
+
+// Middleware returns a requests.Middleware that traces and measures each request.
+func Middleware(opts ...Option) requests.Middleware {
+	cfg := config{
+		tracerProvider: otel.GetTracerProvider(),
+		meterProvider:  otel.GetMeterProvider(),
+		propagators:    propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}),
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&cfg)
+		}
+	}
+
+	meter := cfg.meterProvider.Meter(ScopeName)
+	in := &instruments{
+		tracer:      cfg.tracerProvider.Tracer(ScopeName),
+		propagators: cfg.propagators,
+	}
+	// Instrument creation only fails on invalid names; the no-op fallbacks keep the middleware usable.
+	in.duration, _ = meter.Float64Histogram("http.client.request.duration",
+		metric.WithUnit("s"),
+		metric.WithDescription("Duration of HTTP client requests."),
+		metric.WithExplicitBucketBoundaries(0.005, 0.01, 0.025, 0.05, 0.075, 0.1, 0.25, 0.5, 0.75, 1, 2.5, 5, 7.5, 10))
+	in.requestSize, _ = meter.Int64Histogram("http.client.request.body.size",
+		metric.WithUnit("By"),
+		metric.WithDescription("Size of HTTP client request bodies."))
+	in.responseSize, _ = meter.Int64Histogram("http.client.response.body.size",
+		metric.WithUnit("By"),
+		metric.WithDescription("Size of HTTP client response bodies."))
+
+	return func(next http.RoundTripper) http.RoundTripper {
+		return requests.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return in.roundTrip(next, req)
+		})
+	}
+}
+
+func (in *instruments) roundTrip(next http.RoundTripper, req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	attrs := requestAttrs(req)
+	ctx, span := in.tracer.Start(req.Context(), req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+		trace.WithAttributes(semconv.URLFull(redactedURL(req))),
+	)
+	defer span.End()
+
+	req = req.Clone(ctx)
+	in.propagators.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		errType := attribute.String(string(semconv.ErrorTypeKey), errorType(err))
+		span.SetAttributes(errType)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		attrs = append(attrs, errType)
+	} else {
+		status := semconv.HTTPResponseStatusCode(resp.StatusCode)
+		span.SetAttributes(status)
+		attrs = append(attrs, status)
+		if resp.ProtoMajor > 0 {
+			proto := semconv.NetworkProtocolVersion(protocolVersion(resp))
+			span.SetAttributes(proto)
+			attrs = append(attrs, proto)
+		}
+		if resp.StatusCode >= 400 {
+			errType := attribute.String(string(semconv.ErrorTypeKey), strconv.Itoa(resp.StatusCode))
+			span.SetAttributes(errType)
+			span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+			attrs = append(attrs, errType)
+		}
+	}
+
+	set := metric.WithAttributeSet(attribute.NewSet(attrs...))
+	in.duration.Record(ctx, time.Since(start).Seconds(), set)
+	if req.ContentLength > 0 {
+		in.requestSize.Record(ctx, req.ContentLength, set)
+	}
+	if resp != nil && resp.ContentLength >= 0 {
+		in.responseSize.Record(ctx, resp.ContentLength, set)
+	}
+	return resp, err
+}
+
+func requestAttrs(req *http.Request) []attribute.KeyValue {
+	host, portStr, err := net.SplitHostPort(req.URL.Host)
+	if err != nil {
+		host = req.URL.Host
+		portStr = ""
+	}
+	port, _ := strconv.Atoi(portStr)
+	if port == 0 {
+		switch req.URL.Scheme {
+		case "https":
+			port = 443
+		case "http":
+			port = 80
+		}
+	}
+	attrs := []attribute.KeyValue{
+		semconv.HTTPRequestMethodKey.String(req.Method),
+		semconv.ServerAddress(host),
+	}
+	if port > 0 {
+		attrs = append(attrs, semconv.ServerPort(port))
+	}
+	return attrs
+}
+
+func redactedURL(req *http.Request) string {
+	u := *req.URL
+	if u.User != nil {
+		u.User = url.UserPassword("REDACTED", "REDACTED")
+	}
+	return u.String()
+}
+
+func protocolVersion(resp *http.Response) string {
+	if resp.ProtoMinor == 0 {
+		return strconv.Itoa(resp.ProtoMajor)
+	}
+	return strconv.Itoa(resp.ProtoMajor) + "." + strconv.Itoa(resp.ProtoMinor)
+}
+
+func errorType(err error) string {
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return "timeout"
+	}
+	return "_OTHER"
+}
@@ -0,0 +1,155 @@
+package otel
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	requests "github.com/CareyWang/go-requests"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newProviders() (*tracetest.InMemoryExporter, *sdktrace.TracerProvider, *sdkmetric.ManualReader, *sdkmetric.MeterProvider) {
+	exp := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	return exp, tp, reader, mp
+}
+
+func attrValue(attrs []attribute.KeyValue, key string) attribute.Value {
+	for _, kv := range attrs {
+		if string(kv.Key) == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestMiddlewareCreatesClientSpan(t *testing.T) {
+	exp, tp, reader, mp := newProviders()
+	var traceparent string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("Traceparent")
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+	session := requests.NewSession(requests.WithMiddleware(Middleware(WithTracerProvider(tp), WithMeterProvider(mp))))
+	_, err := session.Post(ctx, srv.URL+"/items", requests.WithBody(http.NoBody))
+	assert.NoError(t, err)
+	parent.End()
+
+	spans := exp.GetSpans()
+	assert.Len(t, spans, 2)
+	span := spans[0]
+	assert.Equal(t, "POST", span.Name)
+	assert.Equal(t, trace.SpanKindClient, span.SpanKind)
+	assert.Equal(t, parent.SpanContext().SpanID(), span.Parent.SpanID())
+	assert.Equal(t, "POST", attrValue(span.Attributes, "http.request.method").AsString())
+	assert.Equal(t, srv.URL+"/items", attrValue(span.Attributes, "url.full").AsString())
+	assert.Equal(t, "127.0.0.1", attrValue(span.Attributes, "server.address").AsString())
+	assert.Equal(t, int64(200), attrValue(span.Attributes, "http.response.status_code").AsInt64())
+	assert.Contains(t, traceparent, span.SpanContext.TraceID().String())
+	assert.Contains(t, traceparent, span.SpanContext.SpanID().String())
+
+	var rm metricdata.ResourceMetrics
+	assert.NoError(t, reader.Collect(context.Background(), &rm))
+	names := map[string]bool{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			names[m.Name] = true
+			if m.Name == "http.client.request.duration" {
+				hist := m.Data.(metricdata.Histogram[float64])
+				assert.Len(t, hist.DataPoints, 1)
+				assert.Equal(t, uint64(1), hist.DataPoints[0].Count)
+			}
+		}
+	}
+	assert.True(t, names["http.client.request.duration"])
+	assert.True(t, names["http.client.response.body.size"])
+}
+
+func TestMiddlewareRecordsErrors(t *testing.T) {
+	exp, tp, _, mp := newProviders()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	mw := requests.WithMiddleware(Middleware(WithTracerProvider(tp), WithMeterProvider(mp)))
+	_, err := requests.Get(context.Background(), srv.URL, mw)
+	assert.ErrorIs(t, err, requests.ErrStatus)
+	_, err = requests.Get(context.Background(), "http://localhost:9999", mw)
+	assert.ErrorIs(t, err, requests.ErrNetwork)
+
+	spans := exp.GetSpans()
+	assert.Len(t, spans, 2)
+	assert.Equal(t, codes.Error, spans[0].Status.Code)
+	assert.Equal(t, "503", attrValue(spans[0].Attributes, "error.type").AsString())
+	assert.Equal(t, codes.Error, spans[1].Status.Code)
+	assert.Equal(t, "_OTHER", attrValue(spans[1].Attributes, "error.type").AsString())
+	assert.Len(t, spans[1].Events, 1)
+}
+
+func TestMiddlewareNestsAttempts(t *testing.T) {
+	exp, tp, _, mp := newProviders()
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+
+	retry := func(next http.RoundTripper) http.RoundTripper {
+		return requests.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			resp, err := next.RoundTrip(req)
+			if err == nil && resp.StatusCode >= 500 {
+				_ = resp.Body.Close()
+				return next.RoundTrip(req)
+			}
+			return resp, err
+		})
+	}
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+	_, err := requests.Get(ctx, srv.URL, requests.WithMiddleware(retry, Middleware(WithTracerProvider(tp), WithMeterProvider(mp))))
+	assert.NoError(t, err)
+	parent.End()
+
+	spans := exp.GetSpans()
+	assert.Len(t, spans, 3)
+	for _, s := range spans[:2] {
+		assert.Equal(t, parent.SpanContext().SpanID(), s.Parent.SpanID())
+	}
+}
+
+func TestMiddlewareSpansRedirects(t *testing.T) {
+	exp, tp, _, mp := newProviders()
+	var parents []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parents = append(parents, r.Header.Get("Traceparent"))
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new", http.StatusFound)
+		}
+	}))
+	defer srv.Close()
+
+	_, err := requests.Get(context.Background(), srv.URL+"/old", requests.WithMiddleware(Middleware(WithTracerProvider(tp), WithMeterProvider(mp))))
+	assert.NoError(t, err)
+	spans := exp.GetSpans()
+	if assert.Len(t, spans, 1) && assert.Len(t, parents, 2) {
+		assert.Contains(t, parents[0], spans[0].SpanContext.SpanID().String())
+		assert.Equal(t, parents[0], parents[1])
+	}
+}
@@ -0,0 +1,136 @@
+package requests
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// RedirectPolicy controls which redirects are followed and how requests are rebuilt for each hop.
+// Redirects that violate the policy fail the request with ErrRedirect.
+type RedirectPolicy struct {
+	// MaxHops is the maximum number of redirects. Zero uses the net/http default of 10
+	// and a negative value disables redirects, returning the 3xx response.
+	MaxHops int
+	// SameHost rejects redirects to a host or port other than the original request's.
+	SameHost bool
+	// AllowedSchemes lists the schemes redirects may target. Empty means http and https.
+	AllowedSchemes []string
+	// AllowDowngrade permits redirects from https to http, which are rejected by default.
+	AllowDowngrade bool
+	// PreserveMethod keeps the method and body on 301 and 302 responses, as 307 and 308 do,
+	// instead of switching to GET. Bodies that cannot be replayed fail the request.
+	PreserveMethod bool
+	// StripHeaders adds header names removed when a hop leaves the original origin
+	// (scheme, host and port). Authorization, Cookie and names containing token, secret,
+	// password, signature or api-key are always removed.
+	StripHeaders []string
+}
+
+// WithRedirectPolicy follows redirects according to p. It replaces WithRedirect.
+func WithRedirectPolicy(p RedirectPolicy) Option {
+	p.AllowedSchemes = slices.Clone(p.AllowedSchemes)
+	p.StripHeaders = slices.Clone(p.StripHeaders)
+	return func(r *Request) {
+		r.redirectPolicy = &p
+		r.redirectMax = nil
+	}
+}
+
+// redirectError is returned from CheckRedirect and classified as ErrRedirect.
+type redirectError struct {
+	reason string
+}
+
+func (e *redirectError) Error() string {
+	return e.reason
+}
+
+func (p *RedirectPolicy) checkRedirect(req *http.Request, via []*http.Request) error {
+	limit := p.MaxHops
+	switch {
+	case limit < 0:
+		return http.ErrUseLastResponse
+	case limit == 0:
+		limit = 10
+	}
+	if len(via) > limit {
+		return &redirectError{fmt.Sprintf("stopped after %d redirects", limit)}
+	}
+
+	first, prev := via[0], via[len(via)-1]
+	schemes := p.AllowedSchemes
+	if len(schemes) == 0 {
+		schemes = []string{"http", "https"}
+	}
+	if !slices.ContainsFunc(schemes, func(s string) bool { return strings.EqualFold(s, req.URL.Scheme) }) {
+		return &redirectError{fmt.Sprintf("redirect to scheme %q not allowed", req.URL.Scheme)}
+	}
+	if !p.AllowDowngrade && prev.URL.Scheme == "https" && req.URL.Scheme == "http" {
+		return &redirectError{"redirect from https to http not allowed"}
+	}
+	if p.SameHost && !strings.EqualFold(req.URL.Host, first.URL.Host) {
+		return &redirectError{fmt.Sprintf("redirect to other host %q not allowed", req.URL.Host)}
+	}
+
+	if p.PreserveMethod && req.Response != nil && req.Method != prev.Method {
+		switch req.Response.StatusCode {
+		case http.StatusMovedPermanently, http.StatusFound:
+			if err := preserveMethod(req, prev); err != nil {
+				return err
+			}
+		}
+	}
+
+	if !sameOrigin(req, first) {
+		for k := range req.Header {
+			if isSensitiveName(k, p.StripHeaders) {
+				req.Header.Del(k)
+			}
+		}
+	}
+	return nil
+}
+
+// preserveMethod rebuilds req with the method, body and body headers of prev.
+func preserveMethod(req, prev *http.Request) error {
+	req.Method = prev.Method
+	if prev.GetBody == nil {
+		if prev.ContentLength != 0 {
+			return &redirectError{fmt.Sprintf("cannot resend %s body on redirect", prev.Method)}
+		}
+		return nil
+	}
+	body, err := prev.GetBody()
+	if err != nil {
+		return err
+	}
+	req.Body = body
+	req.GetBody = prev.GetBody
+	req.ContentLength = prev.ContentLength
+	for _, k := range []string{"Content-Type", "Content-Encoding", "Content-Language"} {
+		if v, ok := prev.Header[k]; ok {
+			req.Header[k] = v
+		}
+	}
+	return nil
+}
+
+func sameOrigin(a, b *http.Request) bool {
+	return strings.EqualFold(a.URL.Scheme, b.URL.Scheme) && strings.EqualFold(canonicalHost(a), canonicalHost(b))
+}
+
+// canonicalHost returns host:port with the default port filled in.
+func canonicalHost(r *http.Request) string {
+	if r.URL.Port() != "" {
+		return r.URL.Host
+	}
+	switch r.URL.Scheme {
+	case "https":
+		return r.URL.Host + ":443"
+	case "http":
+		return r.URL.Host + ":80"
+	}
+	return r.URL.Host
+}
@@ -1,42 +1,155 @@
 package requests
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 )
 
 // Request holds request state built from options.
 type Request struct {
-	method         string
-	url            string
-	headers        http.Header
-	query          url.Values
-	body           io.Reader
-	timeout        time.Duration
-	cookies        []*http.Cookie
-	proxy          *url.URL
-	redirectMax    *int
-	decompressGzip bool
-	err            error
+	method     string
+	url        string
+	baseURL    *url.URL
+	pathParams map[string]string
+	headers    http.Header
+	query      url.Values
+	body       io.Reader
+	// bodySent is set once a body that cannot be replayed has been sent.
+	bodySent           bool
+	timeout            time.Duration
+	cookies            []*http.Cookie
+	proxy              *url.URL
+	proxyFunc          func(*http.Request) (*url.URL, error)
+	proxyConnectHeader http.Header
+	tlsConfig          *tls.Config
+	protocols          *http.Protocols
+	http2Config        *http.HTTP2Config
+	redirectMax        *int
+	redirectPolicy     *RedirectPolicy
+	transport          http.RoundTripper
+	dial               func(ctx context.Context, network, addr string) (net.Conn, error)
+	unixSocket         string
+	resolve            map[string]string
+	resolver           Resolver
+	httpClient         *http.Client
+	// transportChanged is set by options that configure the transport. Session clears it
+	// after its defaults so that sharedTransport is only used when requests add none.
+	transportChanged bool
+	sharedTransport  *http.Transport
+	decompress       []string
+	errorDecoder     func(*Response) any
+	okStatus         func(int) bool
+	log              *logConfig
+	trace            bool
+	middleware       []Middleware
+	metrics          Metrics
+	err              error
+}
+
+// NewRequest builds a Request from options without sending it, for example to render it
+// with ToCurl before sending it with Do. Session.NewRequest also applies session defaults.
+func NewRequest(method, url string, opts ...Option) *Request {
+	return newRequest(method, url, opts...)
+}
+
+// Do sends the request. It can be called more than once when the body is held in memory,
+// as with WithJSON, WithForm or a *bytes.Reader passed to WithBody. Other body readers
+// are consumed by the first send, after which Do returns an ErrRequest error.
+func (r *Request) Do(ctx context.Context) (*Response, error) {
+	return send(ctx, r)
 }
 
 func newRequest(method, rawURL string, opts ...Option) *Request {
 	r := &Request{method: method, url: rawURL}
+	r.apply(opts)
+	return r
+}
+
+func (r *Request) apply(opts []Option) {
 	for _, opt := range opts {
 		if opt != nil {
 			opt(r)
 		}
 	}
-	return r
+}
+
+// requestBody returns the body to send. Readers over in-memory data are copied so
+// the Request can be sent again; other readers can only be used once.
+func (r *Request) requestBody() (io.Reader, error) {
+	switch b := r.body.(type) {
+	case nil:
+		return nil, nil
+	case *bytes.Reader:
+		c := *b
+		return &c, nil
+	case *strings.Reader:
+		c := *b
+		return &c, nil
+	case *bytes.Buffer:
+		return bytes.NewReader(b.Bytes()), nil
+	}
+	if r.bodySent {
+		return nil, fmt.Errorf("body %T was already sent and cannot be replayed", r.body)
+	}
+	r.bodySent = true
+	return r.body, nil
+}
+
+// newHTTPRequest builds the *http.Request to send. Headers are copied so the
+// Request can be built more than once.
+func (r *Request) newHTTPRequest(ctx context.Context) (*http.Request, error) {
+	u, err := r.buildURL()
+	if err != nil {
+		return nil, err
+	}
+	body, err := r.requestBody()
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, r.method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if r.headers != nil {
+		httpReq.Header = r.headers.Clone()
+	}
+	for _, c := range r.cookies {
+		httpReq.AddCookie(c)
+	}
+	if len(r.decompress) > 0 && httpReq.Header.Get("Accept-Encoding") == "" {
+		httpReq.Header.Set("Accept-Encoding", r.acceptEncoding())
+	}
+	return httpReq, nil
+}
+
+// isOK reports whether code counts as success; the default is any 2xx status.
+func (r *Request) isOK(code int) bool {
+	if r.okStatus != nil {
+		return r.okStatus(code)
+	}
+	return code >= 200 && code < 300
 }
 
 func (r *Request) buildURL() (*url.URL, error) {
-	u, err := url.Parse(r.url)
+	raw, err := r.expandPath()
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(raw)
 	if err != nil {
 		return nil, err
 	}
+	if r.baseURL != nil {
+		u = r.baseURL.ResolveReference(u)
+	}
 	if len(r.query) == 0 {
 		return u, nil
 	}
@@ -49,3 +162,38 @@ func (r *Request) buildURL() (*url.URL, error) {
 	u.RawQuery = q.Encode()
 	return u, nil
 }
+
+// expandPath replaces {name} placeholders with escaped path params. Values that are
+// dot segments are rejected so a param cannot change the path it is placed in.
+// URLs are left untouched when no params are set.
+func (r *Request) expandPath() (string, error) {
+	if len(r.pathParams) == 0 {
+		return r.url, nil
+	}
+	var b strings.Builder
+	rest := r.url
+	for {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			break
+		}
+		name := rest[start+1 : start+end]
+		v, ok := r.pathParams[name]
+		if !ok {
+			return "", fmt.Errorf("missing path param %q", name)
+		}
+		// Escaping leaves dot segments intact and URL resolution would remove them.
+		if v == "." || v == ".." {
+			return "", fmt.Errorf("invalid path param %q: %q is a dot segment", name, v)
+		}
+		b.WriteString(rest[:start])
+		b.WriteString(url.PathEscape(v))
+		rest = rest[start+end+1:]
+	}
+	b.WriteString(rest)
+	return b.String(), nil
+}
@@ -0,0 +1,428 @@
+// Package requeststest provides test doubles for code that uses go-requests:
+// record-and-replay cassettes and a MockTransport with expectations.
+//
+// A Cassette records real HTTP interactions to a file and replays them in later
+// runs, so integration tests against third-party APIs do not depend on live
+// sandboxes:
+//
+//	c := requeststest.UseCassette(t, "testdata/github.yaml")
+//	s := requests.NewSession(requests.WithMiddleware(c.Middleware()))
+//
+// Run the tests once with REQUESTS_RECORD=1 (or WithMode(ModeRecord)) to create
+// the cassette, then commit the file.
+package requeststest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf8"
+
+	requests "github.com/CareyWang/go-requests"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrNoInteraction is returned in replay mode when no recorded interaction matches a request.
+// Requests sent through the Middleware report it as requests.ErrNetwork.
+var ErrNoInteraction = errors.New("requeststest: no matching interaction")
+
+// Mode selects whether a Cassette talks to the real server.
+type Mode int
+
+const (
+	// ModeReplay serves recorded responses and fails on unmatched requests.
+	ModeReplay Mode = iota
+	// ModeRecord sends every request to the real server and saves the interactions.
+	ModeRecord
+	// ModeReplayOrRecord replays when the cassette file exists and records otherwise.
+	ModeReplayOrRecord
+)
+
+// RecordEnv is the environment variable that switches UseCassette to ModeRecord when set to a non-empty value.
+const RecordEnv = "REQUESTS_RECORD"
+
+// DefaultScrubHeaders are the header values replaced with REDACTED before a cassette is saved.
+var DefaultScrubHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+
+// Interaction is one recorded request and its response.
+type Interaction struct {
+	Request  RecordedRequest  `json:"request" yaml:"request"`
+	Response RecordedResponse `json:"response" yaml:"response"`
+}
+
+// RecordedRequest is the saved form of a request.
+type RecordedRequest struct {
+	Method  string      `json:"method" yaml:"method"`
+	URL     string      `json:"url" yaml:"url"`
+	Headers http.Header `json:"headers,omitempty" yaml:"headers,omitempty"`
+	Body    Body        `json:"body,omitzero" yaml:"body,omitempty"`
+}
+
+// RecordedResponse is the saved form of a response.
+type RecordedResponse struct {
+	StatusCode int         `json:"status_code" yaml:"status_code"`
+	Headers    http.Header `json:"headers,omitempty" yaml:"headers,omitempty"`
+	Body       Body        `json:"body,omitzero" yaml:"body,omitempty"`
+}
+
+// Body is a saved body. Text bodies are stored verbatim and binary bodies as base64.
+type Body struct {
+	Text     string `json:"text,omitempty" yaml:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty" yaml:"encoding,omitempty"`
+}
+
+func newBody(b []byte) Body {
+	if utf8.Valid(b) {
+		return Body{Text: string(b)}
+	}
+	return Body{Text: base64.StdEncoding.EncodeToString(b), Encoding: "base64"}
+}
+
+// Bytes returns the decoded body.
+func (b Body) Bytes() []byte {
+	if b.Encoding == "base64" {
+		d, err := base64.StdEncoding.DecodeString(b.Text)
+		if err == nil {
+			return d
+		}
+	}
+	return []byte(b.Text)
+}
+
+// IsZero reports whether the body is empty.
+func (b Body) IsZero() bool {
+	return b.Text == ""
+}
+
+// Matcher reports whether a recorded request matches an outgoing request with the given body.
+type Matcher func(req *http.Request, body []byte, rec RecordedRequest) bool
+
+// MatchMethod matches the request method.
+func MatchMethod(req *http.Request, _ []byte, rec RecordedRequest) bool {
+	return req.Method == rec.Method
+}
+
+// MatchURL matches the full request URL.
+func MatchURL(req *http.Request, _ []byte, rec RecordedRequest) bool {
+	return req.URL.String() == rec.URL
+}
+
+// MatchBody matches the request body byte for byte.
+func MatchBody(_ *http.Request, body []byte, rec RecordedRequest) bool {
+	return bytes.Equal(body, rec.Body.Bytes())
+}
+
+// MatchHeaders matches the values of the named headers. Scrubbed headers never match.
+func MatchHeaders(names ...string) Matcher {
+	return func(req *http.Request, _ []byte, rec RecordedRequest) bool {
+		for _, name := range names {
+			if !slices.Equal(req.Header.Values(name), rec.Headers.Values(name)) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Option configures a Cassette.
+type Option func(*Cassette)
+
+// WithMode sets the mode. The default is ModeReplay.
+func WithMode(m Mode) Option {
+	return func(c *Cassette) {
+		c.mode = m
+	}
+}
+
+// WithMatchers replaces the default matchers, MatchMethod and MatchURL. A recorded
+// interaction is used only when every matcher accepts it.
+func WithMatchers(m ...Matcher) Option {
+	return func(c *Cassette) {
+		c.matchers = m
+	}
+}
+
+// WithScrubHeaders adds header names whose values are replaced with REDACTED on save.
+func WithScrubHeaders(names ...string) Option {
+	return func(c *Cassette) {
+		c.scrub = append(c.scrub, names...)
+	}
+}
+
+// WithRealTransport sets the transport used for recording when the Cassette is used as
+// an http.RoundTripper. It defaults to http.DefaultTransport.
+func WithRealTransport(rt http.RoundTripper) Option {
+	return func(c *Cassette) {
+		c.real = rt
+	}
+}
+
+// Cassette records and replays HTTP interactions stored in a YAML or JSON file.
+// The format follows the file extension: ".json" selects JSON, anything else YAML.
+// Each recorded interaction is replayed at most once, in recorded order among matches.
+// Use it as a requests.Middleware or as the http.RoundTripper of an http.Client.
+type Cassette struct {
+	path     string
+	mode     Mode
+	matchers []Matcher
+	scrub    []string
+	real     http.RoundTripper
+	tb       testing.TB
+
+	mu           sync.Mutex
+	interactions []Interaction
+	used         []bool
+	dirty        bool
+}
+
+// Load opens the cassette at path. In ModeReplay the file must exist.
+func Load(path string, opts ...Option) (*Cassette, error) {
+	c := &Cassette{
+		path:     path,
+		matchers: []Matcher{MatchMethod, MatchURL},
+		scrub:    slices.Clone(DefaultScrubHeaders),
+		real:     http.DefaultTransport,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(c)
+		}
+	}
+
+	b, err := os.ReadFile(path)
+	switch {
+	case err == nil && c.mode != ModeRecord:
+		if c.isJSON() {
+			err = json.Unmarshal(b, &c.interactions)
+		} else {
+			err = yaml.Unmarshal(b, &c.interactions)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("requeststest: decode %s: %w", path, err)
+		}
+		c.used = make([]bool, len(c.interactions))
+		c.mode = ModeReplay
+	case errors.Is(err, os.ErrNotExist) && c.mode == ModeReplayOrRecord:
+		c.mode = ModeRecord
+	case err != nil && c.mode != ModeRecord:
+		return nil, fmt.Errorf("requeststest: %w", err)
+	}
+	return c, nil
+}
+
+// UseCassette loads the cassette at path for the duration of a test. The mode is
+// ModeRecord when RecordEnv is set and ModeReplay otherwise; opts are applied after.
+// Load errors and unmatched requests fail the test, and the cassette is saved when the test finishes.
+func UseCassette(t testing.TB, path string, opts ...Option) *Cassette {
+	t.Helper()
+	mode := ModeReplay
+	if os.Getenv(RecordEnv) != "" {
+		mode = ModeRecord
+	}
+	c, err := Load(path, append([]Option{WithMode(mode)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.tb = t
+	t.Cleanup(func() {
+		if err := c.Save(); err != nil {
+			t.Error(err)
+		}
+	})
+	return c
+}
+
+// Mode returns the effective mode; ModeReplayOrRecord resolves to ModeReplay or ModeRecord on Load.
+func (c *Cassette) Mode() Mode {
+	return c.mode
+}
+
+// Interactions returns a copy of the recorded interactions.
+func (c *Cassette) Interactions() []Interaction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.interactions)
+}
+
+// Middleware returns a requests.Middleware that serves requests from the cassette.
+// In record mode requests continue down the chain and the final responses are saved.
+func (c *Cassette) Middleware() requests.Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return requests.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			return c.roundTrip(next, req)
+		})
+	}
+}
+
+// RoundTrip implements http.RoundTripper using the real transport for recording.
+func (c *Cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	return c.roundTrip(c.real, req)
+}
+
+func (c *Cassette) roundTrip(next http.RoundTripper, req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	if c.mode != ModeRecord {
+		return c.replay(req, body)
+	}
+
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.interactions = append(c.interactions, Interaction{
+		Request: RecordedRequest{
+			Method:  req.Method,
+			URL:     req.URL.String(),
+			Headers: c.scrubbed(req.Header),
+			Body:    newBody(body),
+		},
+		Response: RecordedResponse{
+			StatusCode: resp.StatusCode,
+			Headers:    c.scrubbed(resp.Header),
+			Body:       newBody(respBody),
+		},
+	})
+	c.used = append(c.used, true)
+	c.dirty = true
+	return resp, nil
+}
+
+func (c *Cassette) replay(req *http.Request, body []byte) (*http.Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, in := range c.interactions {
+		if c.used[i] || !c.matches(req, body, in.Request) {
+			continue
+		}
+		c.used[i] = true
+		b := in.Response.Body.Bytes()
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", in.Response.StatusCode, http.StatusText(in.Response.StatusCode)),
+			StatusCode:    in.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        in.Response.Headers.Clone(),
+			Body:          io.NopCloser(bytes.NewReader(b)),
+			ContentLength: int64(len(b)),
+			Request:       req,
+		}, nil
+	}
+	err := fmt.Errorf("%w for %s %s", ErrNoInteraction, req.Method, req.URL)
+	if c.tb != nil {
+		c.tb.Error(err)
+	}
+	return nil, err
+}
+
+func (c *Cassette) matches(req *http.Request, body []byte, rec RecordedRequest) bool {
+	for _, m := range c.matchers {
+		if !m(req, body, rec) {
+			return false
+		}
+	}
+	return true
+}
+
+// Unused returns the recorded interactions that have not been replayed.
+func (c *Cassette) Unused() []Interaction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var out []Interaction
+	for i, in := range c.interactions {
+		if !c.used[i] {
+			out = append(out, in)
+		}
+	}
+	return out
+}
+
+// Save writes recorded interactions to the cassette file. It does nothing in replay mode.
+func (c *Cassette) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.dirty {
+		return nil
+	}
+	var (
+		b   []byte
+		err error
+	)
+	if c.isJSON() {
+		b, err = json.MarshalIndent(c.interactions, "", "  ")
+	} else {
+		b, err = yaml.Marshal(c.interactions)
+	}
+	if err != nil {
+		return fmt.Errorf("requeststest: encode %s: %w", c.path, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return fmt.Errorf("requeststest: %w", err)
+	}
+	if err := os.WriteFile(c.path, b, 0o644); err != nil {
+		return fmt.Errorf("requeststest: %w", err)
+	}
+	c.dirty = false
+	return nil
+}
+
+func (c *Cassette) isJSON() bool {
+	return strings.EqualFold(filepath.Ext(c.path), ".json")
+}
+
+func (c *Cassette) scrubbed(h http.Header) http.Header {
+	if len(h) == 0 {
+		return nil
+	}
+	out := h.Clone()
+	for _, name := range c.scrub {
+		if _, ok := out[http.CanonicalHeaderKey(name)]; ok {
+			out[http.CanonicalHeaderKey(name)] = []string{"REDACTED"}
+		}
+	}
+	return out
+}
+
+// readRequestBody returns the request body and leaves req with an unread copy.
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	if req.GetBody != nil {
+		rc, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return io.ReadAll(rc)
+	}
+	b, err := io.ReadAll(req.Body)
+	_ = req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(b))
+	return b, nil
+}
@@ -0,0 +1,122 @@
+package requeststest
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	requests "github.com/CareyWang/go-requests"
+	"github.com/stretchr/testify/assert"
+)
+
+func newEchoServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		w.Header().Set("Set-Cookie", "sid=secret")
+		w.Header().Set("X-Path", r.URL.Path)
+		_, _ = io.WriteString(w, r.Method+" "+string(b))
+	}))
+}
+
+func TestCassetteRecordAndReplay(t *testing.T) {
+	for _, name := range []string{"cassette.yaml", "cassette.json"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "testdata", name)
+			srv := newEchoServer()
+
+			rec, err := Load(path, WithMode(ModeRecord))
+			assert.NoError(t, err)
+			s := requests.NewSession(requests.WithMiddleware(rec.Middleware()), requests.WithHeader("Authorization", "Bearer token"))
+			resp, err := s.Post(context.Background(), srv.URL+"/items", requests.WithBody(strings.NewReader("a=1")))
+			assert.NoError(t, err)
+			text, _ := resp.Text()
+			assert.Equal(t, "POST a=1", text)
+			assert.NoError(t, rec.Save())
+			srv.Close()
+
+			saved, err := os.ReadFile(path)
+			assert.NoError(t, err)
+			assert.NotContains(t, string(saved), "Bearer token")
+			assert.NotContains(t, string(saved), "sid=secret")
+
+			play, err := Load(path, WithMatchers(MatchMethod, MatchURL, MatchBody))
+			assert.NoError(t, err)
+			assert.Equal(t, ModeReplay, play.Mode())
+			s = requests.NewSession(requests.WithMiddleware(play.Middleware()))
+			resp, err = s.Post(context.Background(), srv.URL+"/items", requests.WithBody(strings.NewReader("a=1")))
+			assert.NoError(t, err)
+			text, _ = resp.Text()
+			assert.Equal(t, "POST a=1", text)
+			assert.Equal(t, "/items", resp.Headers.Get("X-Path"))
+			assert.Empty(t, play.Unused())
+
+			_, err = s.Post(context.Background(), srv.URL+"/items", requests.WithBody(strings.NewReader("a=1")))
+			assert.ErrorIs(t, err, requests.ErrNetwork)
+			assert.ErrorContains(t, err, ErrNoInteraction.Error())
+		})
+	}
+}
+
+func TestCassetteMatchers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "c.yaml")
+	srv := newEchoServer()
+	rec, err := Load(path, WithMode(ModeReplayOrRecord))
+	assert.NoError(t, err)
+	assert.Equal(t, ModeRecord, rec.Mode())
+
+	client := &http.Client{Transport: rec}
+	for _, body := range []string{"one", "two"} {
+		req, _ := http.NewRequest(http.MethodPut, srv.URL+"/x", strings.NewReader(body))
+		req.Header.Set("X-Tenant", body)
+		resp, err := client.Do(req)
+		assert.NoError(t, err)
+		_ = resp.Body.Close()
+	}
+	assert.NoError(t, rec.Save())
+	srv.Close()
+
+	play, err := Load(path, WithMode(ModeReplayOrRecord), WithMatchers(MatchMethod, MatchHeaders("X-Tenant")))
+	assert.NoError(t, err)
+	assert.Equal(t, ModeReplay, play.Mode())
+	req, _ := http.NewRequest(http.MethodPut, "http://elsewhere/y", nil)
+	req.Header.Set("X-Tenant", "two")
+	resp, err := (&http.Client{Transport: play}).Do(req)
+	assert.NoError(t, err)
+	b, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "PUT two", string(b))
+	assert.Len(t, play.Unused(), 1)
+}
+
+func TestLoadMissingCassette(t *testing.T) {
+	_, err := Load(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestUseCassetteFailsOnUnmatched(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "empty.json")
+	assert.NoError(t, os.WriteFile(path, []byte("[]"), 0o644))
+
+	ft := &fakeT{TB: t}
+	c := UseCassette(ft, path)
+	_, err := requests.Get(context.Background(), "http://example.com", requests.WithMiddleware(c.Middleware()))
+	assert.ErrorContains(t, err, ErrNoInteraction.Error())
+	assert.True(t, ft.failed)
+}
+
+type fakeT struct {
+	testing.TB
+	failed bool
+}
+
+func (f *fakeT) Error(args ...any) {
+	f.failed = true
+}
+
+func (f *fakeT) Errorf(format string, args ...any) {
+	f.failed = true
+}
@@ -0,0 +1,21 @@
+module github.com/CareyWang/go-requests/requeststest
+
+go 1.25
+
+require (
+	github.com/CareyWang/go-requests v0.0.0-20261018154427-fccad04151e0
+	github.com/stretchr/testify v1.11.1
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/andybalholm/brotli v1.2.6 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/klauspost/compress v1.20.1 // indirect
+	github.com/kr/text v0.2.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/net v0.43.0 // indirect
+	golang.org/x/text v0.28.0 // indirect
+)
+
+replace github.com/CareyWang/go-requests => ../
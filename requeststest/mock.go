@@ -0,0 +1,270 @@
+package requeststest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+
+	requests "github.com/CareyWang/go-requests"
+)
+
+// ErrUnexpectedRequest is returned by MockTransport for requests that match no expectation.
+// Requests sent through the Middleware report it as requests.ErrNetwork.
+var ErrUnexpectedRequest = errors.New("requeststest: unexpected request")
+
+// MockTransport serves canned responses for expected requests without network access.
+// Register expectations with On before sending requests; the first expectation that
+// matches and has calls left answers the request. It is safe for concurrent use and
+// needs no global state, so tests using it can run in parallel.
+//
+//	m := requeststest.NewMockTransport()
+//	m.On(http.MethodGet, "/users/1").RespondJSON(http.StatusOK, user)
+//	s := requests.NewSession(requests.WithMiddleware(m.Middleware()))
+//	// ...
+//	m.AssertExpectations(t)
+type MockTransport struct {
+	mu           sync.Mutex
+	expectations []*Expectation
+	unexpected   []string
+}
+
+// NewMockTransport creates a MockTransport with no expectations.
+func NewMockTransport() *MockTransport {
+	return &MockTransport{}
+}
+
+// On registers an expected request with the given method and URL path. An empty method matches any method.
+func (m *MockTransport) On(method, path string) *Expectation {
+	e := &Expectation{mock: m, method: method, path: path, status: http.StatusOK}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expectations = append(m.expectations, e)
+	return e
+}
+
+// Middleware returns a requests.Middleware that answers requests from the mock
+// instead of sending them.
+func (m *MockTransport) Middleware() requests.Middleware {
+	return func(http.RoundTripper) http.RoundTripper {
+		return m
+	}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (m *MockTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	var match *Expectation
+	for _, e := range m.expectations {
+		if e.exhausted() || !e.matches(req, body) {
+			continue
+		}
+		match = e
+		e.calls++
+		break
+	}
+	if match == nil {
+		m.unexpected = append(m.unexpected, req.Method+" "+req.URL.String())
+	}
+	m.mu.Unlock()
+
+	if match == nil {
+		return nil, fmt.Errorf("%w: %s %s", ErrUnexpectedRequest, req.Method, req.URL)
+	}
+	if match.err != nil {
+		return nil, match.err
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", match.status, http.StatusText(match.status)),
+		StatusCode:    match.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        match.header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(match.body)),
+		ContentLength: int64(len(match.body)),
+		Request:       req,
+	}, nil
+}
+
+// Calls returns the number of requests answered by any expectation.
+func (m *MockTransport) Calls() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for _, e := range m.expectations {
+		n += e.calls
+	}
+	return n
+}
+
+// AssertExpectations fails t when an expectation was called fewer times than required
+// or a request matched no expectation. It reports whether all expectations were met.
+func (m *MockTransport) AssertExpectations(t testing.TB) bool {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ok := true
+	for _, e := range m.expectations {
+		want := max(e.times, 1)
+		if e.calls < want {
+			t.Errorf("requeststest: expected %s %s to be called %d time(s), got %d", e.method, e.path, want, e.calls)
+			ok = false
+		}
+	}
+	for _, u := range m.unexpected {
+		t.Errorf("requeststest: unexpected request %s", u)
+		ok = false
+	}
+	return ok
+}
+
+// Expectation describes an expected request and its canned response.
+// Configure it before sending requests through the MockTransport.
+type Expectation struct {
+	mock     *MockTransport
+	method   string
+	path     string
+	query    [][2]string
+	headers  [][2]string
+	jsonBody any
+	hasJSON  bool
+	matchers []func(*http.Request, []byte) bool
+
+	status int
+	header http.Header
+	body   []byte
+	err    error
+	times  int
+	calls  int
+}
+
+// WithQuery requires the query parameter key to have value among its values.
+func (e *Expectation) WithQuery(key, value string) *Expectation {
+	e.query = append(e.query, [2]string{key, value})
+	return e
+}
+
+// WithHeader requires the request header key to have value among its values.
+func (e *Expectation) WithHeader(key, value string) *Expectation {
+	e.headers = append(e.headers, [2]string{key, value})
+	return e
+}
+
+// WithJSONBody requires the request body to be JSON equal to v, ignoring formatting and key order.
+func (e *Expectation) WithJSONBody(v any) *Expectation {
+	b, err := json.Marshal(v)
+	if err == nil {
+		err = json.Unmarshal(b, &e.jsonBody)
+	}
+	if err != nil {
+		panic(fmt.Sprintf("requeststest: WithJSONBody: %v", err))
+	}
+	e.hasJSON = true
+	return e
+}
+
+// Match adds a custom matcher that receives the request and its body.
+func (e *Expectation) Match(fn func(req *http.Request, body []byte) bool) *Expectation {
+	e.matchers = append(e.matchers, fn)
+	return e
+}
+
+// Respond sets the response status and body.
+func (e *Expectation) Respond(status int, body string) *Expectation {
+	e.status = status
+	e.body = []byte(body)
+	return e
+}
+
+// RespondJSON sets the response status and a JSON-encoded body with a JSON Content-Type.
+func (e *Expectation) RespondJSON(status int, v any) *Expectation {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(fmt.Sprintf("requeststest: RespondJSON: %v", err))
+	}
+	e.status = status
+	e.body = b
+	return e.WithResponseHeader("Content-Type", "application/json")
+}
+
+// WithResponseHeader adds a response header.
+func (e *Expectation) WithResponseHeader(key, value string) *Expectation {
+	if e.header == nil {
+		e.header = make(http.Header)
+	}
+	e.header.Add(key, value)
+	return e
+}
+
+// RespondError makes the transport fail with err instead of responding.
+func (e *Expectation) RespondError(err error) *Expectation {
+	e.err = err
+	return e
+}
+
+// Times limits the expectation to n calls and requires exactly that many for AssertExpectations.
+// Without Times an expectation answers any number of calls and must be called at least once.
+func (e *Expectation) Times(n int) *Expectation {
+	e.times = n
+	return e
+}
+
+// Once is Times(1).
+func (e *Expectation) Once() *Expectation {
+	return e.Times(1)
+}
+
+// Calls returns how many requests the expectation answered.
+func (e *Expectation) Calls() int {
+	e.mock.mu.Lock()
+	defer e.mock.mu.Unlock()
+	return e.calls
+}
+
+func (e *Expectation) exhausted() bool {
+	return e.times > 0 && e.calls >= e.times
+}
+
+func (e *Expectation) matches(req *http.Request, body []byte) bool {
+	if e.method != "" && req.Method != e.method {
+		return false
+	}
+	if req.URL.Path != e.path {
+		return false
+	}
+	q := req.URL.Query()
+	for _, kv := range e.query {
+		if !slices.Contains(q[kv[0]], kv[1]) {
+			return false
+		}
+	}
+	for _, kv := range e.headers {
+		if !slices.Contains(req.Header.Values(kv[0]), kv[1]) {
+			return false
+		}
+	}
+	if e.hasJSON {
+		var got any
+		if json.Unmarshal(body, &got) != nil || !reflect.DeepEqual(got, e.jsonBody) {
+			return false
+		}
+	}
+	for _, fn := range e.matchers {
+		if !fn(req, body) {
+			return false
+		}
+	}
+	return true
+}
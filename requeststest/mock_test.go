@@ -0,0 +1,85 @@
+package requeststest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	requests "github.com/CareyWang/go-requests"
+	"github.com/stretchr/testify/assert"
+)
+
+type user struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestMockTransport(t *testing.T) {
+	t.Parallel()
+	m := NewMockTransport()
+	get := m.On(http.MethodGet, "/users/1").
+		WithQuery("expand", "teams").
+		WithHeader("Accept", "application/json").
+		RespondJSON(http.StatusOK, user{ID: 1, Name: "alice"})
+	create := m.On(http.MethodPost, "/users").
+		WithJSONBody(map[string]any{"name": "bob"}).
+		RespondJSON(http.StatusCreated, user{ID: 2, Name: "bob"}).
+		Once()
+
+	s := requests.NewSession(requests.WithBaseURL("https://api.example.com"), requests.WithMiddleware(m.Middleware()))
+	ctx := context.Background()
+	for range 2 {
+		u, _, err := requests.SessionGetJSON[user](ctx, s, "/users/1", requests.WithQuery(map[string]string{"expand": "teams"}))
+		assert.NoError(t, err)
+		assert.Equal(t, "alice", u.Name)
+	}
+	u, _, err := requests.SessionPostJSON[map[string]string, user](ctx, s, "/users", map[string]string{"name": "bob"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, u.ID)
+
+	_, _, err = requests.SessionPostJSON[map[string]string, user](ctx, s, "/users", map[string]string{"name": "bob"})
+	assert.ErrorIs(t, err, requests.ErrNetwork)
+	assert.ErrorContains(t, err, ErrUnexpectedRequest.Error())
+
+	assert.Equal(t, 2, get.Calls())
+	assert.Equal(t, 1, create.Calls())
+	assert.Equal(t, 3, m.Calls())
+
+	ft := &fakeT{TB: t}
+	assert.False(t, m.AssertExpectations(ft))
+	assert.True(t, ft.failed)
+}
+
+func TestMockTransportErrorsAndStatus(t *testing.T) {
+	t.Parallel()
+	m := NewMockTransport()
+	m.On(http.MethodDelete, "/items/1").Respond(http.StatusNotFound, "missing")
+	m.On("", "/flaky").RespondError(errors.New("connection reset"))
+
+	_, err := requests.Delete(context.Background(), "http://svc/items/1", requests.WithMiddleware(m.Middleware()))
+	var se *requests.StatusError
+	if assert.ErrorAs(t, err, &se) {
+		assert.Equal(t, http.StatusNotFound, se.StatusCode)
+	}
+
+	_, err = requests.Get(context.Background(), "http://svc/flaky", requests.WithMiddleware(m.Middleware()))
+	assert.ErrorIs(t, err, requests.ErrNetwork)
+	assert.ErrorContains(t, err, "connection reset")
+
+	assert.True(t, m.AssertExpectations(t))
+}
+
+func TestMockTransportUnmetExpectation(t *testing.T) {
+	t.Parallel()
+	m := NewMockTransport()
+	m.On(http.MethodGet, "/a").Times(2)
+
+	resp, err := (&http.Client{Transport: m}).Get("http://svc/a")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	ft := &fakeT{TB: t}
+	assert.False(t, m.AssertExpectations(ft))
+	assert.True(t, ft.failed)
+}
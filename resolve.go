@@ -0,0 +1,170 @@
+package requests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Resolver looks up the IP addresses of a host. *net.Resolver implements it.
+type Resolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// WithResolve connects to addr whenever a connection to hostPort is opened, like curl --resolve.
+// addr is an IP, which keeps the port of hostPort, or a host:port pair. The URL, Host header
+// and TLS server name are unchanged. It can be given several times for different hosts.
+func WithResolve(hostPort, addr string) Option {
+	return func(r *Request) {
+		if r.err != nil {
+			return
+		}
+		_, port, err := net.SplitHostPort(hostPort)
+		if err != nil {
+			r.err = fmt.Errorf("resolve %q: %w", hostPort, err)
+			return
+		}
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			addr = net.JoinHostPort(addr, port)
+		}
+		if r.resolve == nil {
+			r.resolve = make(map[string]string)
+		}
+		r.resolve[hostPort] = addr
+		r.transportChanged = true
+	}
+}
+
+// WithResolver looks up host names with res instead of the system resolver.
+// The returned addresses are tried in order until a connection succeeds.
+func WithResolver(res Resolver) Option {
+	return func(r *Request) {
+		r.resolver = res
+		r.transportChanged = true
+	}
+}
+
+// dialContext returns the dial function for the request: overrides from WithResolve first,
+// then the custom resolver, then the dialer set with WithDialContext or a net.Dialer.
+// It returns nil when the transport's own dialer can be used.
+func (r *Request) dialContext() func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if r.resolve == nil && r.resolver == nil {
+		return r.dial
+	}
+	dial := r.dial
+	if dial == nil {
+		d := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+		dial = d.DialContext
+	}
+	resolve, resolver := r.resolve, r.resolver
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if to, ok := resolve[addr]; ok {
+			return dial(ctx, network, to)
+		}
+		if resolver == nil {
+			return dial(ctx, network, addr)
+		}
+		return dialResolved(ctx, resolver, dial, network, addr)
+	}
+}
+
+// dialResolved looks up the host of addr with resolver and dials the returned
+// addresses in order until a connection succeeds. IP addresses are dialed as they are.
+func dialResolved(ctx context.Context, resolver Resolver, dial func(ctx context.Context, network, addr string) (net.Conn, error), network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return dial(ctx, network, addr)
+	}
+	ips, err := resolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	var errs []error
+	for _, ip := range ips {
+		conn, err := dial(ctx, network, net.JoinHostPort(ip, port))
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, errors.Join(errs...)
+}
+
+// DefaultDNSCacheTTL is the TTL used by NewDNSCache when ttl is not positive.
+const DefaultDNSCacheTTL = time.Minute
+
+// DNSCache is a Resolver that caches lookups for a fixed TTL and rotates the
+// returned addresses on every lookup to spread connections across them.
+// Failed lookups are not cached. Share one cache through a Session:
+//
+//	s := NewSession(WithResolver(NewDNSCache(nil, 30*time.Second)))
+type DNSCache struct {
+	resolver Resolver
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*dnsEntry
+}
+
+type dnsEntry struct {
+	addrs   []string
+	expires time.Time
+	next    int
+}
+
+// NewDNSCache caches the results of res, or net.DefaultResolver when res is nil, for ttl.
+func NewDNSCache(res Resolver, ttl time.Duration) *DNSCache {
+	if res == nil {
+		res = net.DefaultResolver
+	}
+	if ttl <= 0 {
+		ttl = DefaultDNSCacheTTL
+	}
+	return &DNSCache{resolver: res, ttl: ttl, entries: make(map[string]*dnsEntry)}
+}
+
+// LookupHost returns the cached addresses of host, starting with the next address in rotation.
+func (c *DNSCache) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if addrs, ok := c.cached(host); ok {
+		return addrs, nil
+	}
+	addrs, err := c.resolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.entries[host] = &dnsEntry{addrs: addrs, expires: time.Now().Add(c.ttl), next: 1}
+	c.mu.Unlock()
+	return slices.Clone(addrs), nil
+}
+
+func (c *DNSCache) cached(host string) ([]string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := c.entries[host]
+	if e == nil || time.Now().After(e.expires) || len(e.addrs) == 0 {
+		return nil, false
+	}
+	start := e.next % len(e.addrs)
+	e.next++
+	out := make([]string, 0, len(e.addrs))
+	out = append(out, e.addrs[start:]...)
+	return append(out, e.addrs[:start]...), true
+}
+
+// Flush removes all cached entries, for example after a blue/green cutover.
+func (c *DNSCache) Flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clear(c.entries)
+}
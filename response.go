@@ -1,11 +1,12 @@
 package requests
 
 import (
-	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"sync"
+	"time"
 )
 
 // Response wraps http.Response with convenience helpers.
@@ -13,10 +14,26 @@ type Response struct {
 	Raw        *http.Response
 	StatusCode int
 	Headers    http.Header
+	// Proto is the negotiated protocol, such as "HTTP/1.1" or "HTTP/2.0".
+	Proto string
+	// URL is the URL the response was served from, after any redirects.
+	URL *url.URL
+	// Request is the request that produced the response, with sensitive headers
+	// and query parameters redacted.
+	Request *SentRequest
+	// Elapsed is the time from sending the request until the response headers
+	// arrived, including redirects. It is zero for History entries.
+	Elapsed time.Duration
+	// History holds the redirect responses that led to this one, oldest first.
+	// Their bodies have already been closed.
+	History []*Response
 
 	once    sync.Once
 	body    []byte
 	bodyErr error
+	trace   *tracer
+	req     *Request
+	sent    *http.Request
 }
 
 func newResponse(resp *http.Response) *Response {
@@ -27,9 +44,41 @@ func newResponse(resp *http.Response) *Response {
 		Raw:        resp,
 		StatusCode: resp.StatusCode,
 		Headers:    resp.Header,
+		Proto:      resp.Proto,
+		URL:        requestURL(resp.Request),
+		Request:    newSentRequest(resp.Request),
 	}
 }
 
+// SentRequest describes a request as it was sent.
+type SentRequest struct {
+	Method string
+	// URL is the request URL with the password and sensitive query parameters redacted.
+	URL string
+	// Headers are the request headers with sensitive values redacted. Headers added
+	// by the transport, such as Accept-Encoding, are not included.
+	Headers http.Header
+}
+
+func newSentRequest(req *http.Request) *SentRequest {
+	if req == nil {
+		return nil
+	}
+	return &SentRequest{
+		Method:  req.Method,
+		URL:     redactURL(req.URL),
+		Headers: redactHeaders(req.Header.Clone(), nil),
+	}
+}
+
+func requestURL(req *http.Request) *url.URL {
+	if req == nil || req.URL == nil {
+		return nil
+	}
+	u := *req.URL
+	return &u
+}
+
 // Bytes reads and caches the response body and returns ErrResponseNil on nil responses.
 func (r *Response) Bytes() ([]byte, error) {
 	if r == nil || r.Raw == nil || r.Raw.Body == nil {
@@ -51,7 +100,8 @@ func (r *Response) Text() (string, error) {
 	return string(b), err
 }
 
-// JSON decodes the response body into v and returns ErrNoContent on empty bodies.
+// JSON decodes the response body into v with the codec registered for application/json
+// and returns ErrNoContent on empty bodies.
 func (r *Response) JSON(v any) error {
 	b, err := r.Bytes()
 	if err != nil {
@@ -60,8 +110,38 @@ func (r *Response) JSON(v any) error {
 	if len(b) == 0 {
 		return ErrNoContent
 	}
-	if err := json.Unmarshal(b, v); err != nil {
+	if err := jsonCodec().Unmarshal(b, v); err != nil {
 		return fmt.Errorf("%w: %v", ErrResponse, err)
 	}
 	return nil
 }
+
+// Decode decodes the response body into v using the codec registered for the response Content-Type.
+// It returns ErrNoContent on empty bodies and ErrResponse when no codec matches or decoding fails.
+func (r *Response) Decode(v any) error {
+	b, err := r.Bytes()
+	if err != nil {
+		return err
+	}
+	if len(b) == 0 {
+		return ErrNoContent
+	}
+	ct := r.Headers.Get("Content-Type")
+	codec, ok := CodecFor(ct)
+	if !ok {
+		return fmt.Errorf("%w: no codec for content type %q", ErrResponse, ct)
+	}
+	if err := codec.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("%w: %v", ErrResponse, err)
+	}
+	return nil
+}
+
+// Timings returns the latency breakdown of a request sent with WithTrace.
+// It returns zero Timings when tracing was not enabled.
+func (r *Response) Timings() Timings {
+	if r == nil || r.trace == nil {
+		return Timings{}
+	}
+	return r.trace.timings()
+}
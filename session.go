@@ -3,11 +3,19 @@ package requests
 import (
 	"context"
 	"net/http"
+	"sync"
 )
 
-// Session holds default options for requests.
+// Session holds default options for requests. Transport options among the defaults, such as
+// WithProxy, WithTLSConfig, WithResolver or WithHTTP2Config, build one transport that is shared
+// by the session's requests, so connections are reused. Requests that add their own transport
+// options use a transport of their own without keep-alives.
 type Session struct {
 	opts []Option
+
+	transportOnce sync.Once
+	transport     *http.Transport
+	transportErr  error
 }
 
 // NewSession creates a new session with default options.
@@ -52,9 +60,36 @@ func (s *Session) Options(ctx context.Context, url string, opts ...Option) (*Res
 	return s.do(ctx, http.MethodOptions, url, opts...)
 }
 
+// Do sends a request with the given method using session defaults.
+func (s *Session) Do(ctx context.Context, method, url string, opts ...Option) (*Response, error) {
+	return s.do(ctx, method, url, opts...)
+}
+
+// NewRequest builds a Request from the session defaults and opts without sending it.
+// See NewRequest.
+func (s *Session) NewRequest(method, url string, opts ...Option) *Request {
+	r := newRequest(method, url, s.opts...)
+	if r.transportChanged && r.err == nil {
+		r.sharedTransport, r.err = s.sharedTransport(r)
+		r.transportChanged = false
+	}
+	r.apply(opts)
+	return r
+}
+
 func (s *Session) do(ctx context.Context, method, url string, opts ...Option) (*Response, error) {
-	all := make([]Option, 0, len(s.opts)+len(opts))
-	all = append(all, s.opts...)
-	all = append(all, opts...)
-	return do(ctx, method, url, all...)
+	return send(ctx, s.NewRequest(method, url, opts...))
+}
+
+// sharedTransport builds the session transport from r, a request with only the session
+// defaults applied, the first time it is needed.
+func (s *Session) sharedTransport(r *Request) (*http.Transport, error) {
+	s.transportOnce.Do(func() {
+		base := r.transport
+		if base == nil && r.httpClient != nil {
+			base = r.httpClient.Transport
+		}
+		s.transport, s.transportErr = buildTransport(r, base)
+	})
+	return s.transport, s.transportErr
 }
@@ -0,0 +1,144 @@
+package requests
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Timings breaks down the latency of a request sent with WithTrace.
+// Phases that did not happen, such as DNS for IP literals or connect on a reused
+// connection, are zero. With redirects the connection phases describe the last hop.
+type Timings struct {
+	// DNS is the duration of the host lookup.
+	DNS time.Duration
+	// Connect is the duration of the TCP connect.
+	Connect time.Duration
+	// TLS is the duration of the TLS handshake.
+	TLS time.Duration
+	// FirstByte is the time from the start of the request to the first response byte.
+	FirstByte time.Duration
+	// Transfer is the time spent reading the body after the first byte; zero until the body is fully read.
+	Transfer time.Duration
+	// Total is the time from the start of the request to the end of the body,
+	// or to the first byte while the body has not been fully read.
+	Total time.Duration
+	// Reused reports whether the connection was taken from the idle pool.
+	Reused bool
+	// RemoteAddr is the address of the connected server or proxy.
+	RemoteAddr string
+}
+
+type tracer struct {
+	mu         sync.Mutex
+	start      time.Time
+	dnsStart   time.Time
+	dnsDone    time.Time
+	connStart  time.Time
+	connDone   time.Time
+	tlsStart   time.Time
+	tlsDone    time.Time
+	firstByte  time.Time
+	bodyDone   time.Time
+	reused     bool
+	remoteAddr string
+}
+
+func newTracer() *tracer {
+	return &tracer{start: time.Now()}
+}
+
+func (t *tracer) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.set(&t.dnsStart)
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.set(&t.dnsDone)
+		},
+		ConnectStart: func(string, string) {
+			t.set(&t.connStart)
+		},
+		ConnectDone: func(string, string, error) {
+			t.set(&t.connDone)
+		},
+		TLSHandshakeStart: func() {
+			t.set(&t.tlsStart)
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.set(&t.tlsDone)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.reused = info.Reused
+			if info.Conn != nil {
+				t.remoteAddr = info.Conn.RemoteAddr().String()
+			}
+		},
+		GotFirstResponseByte: func() {
+			t.set(&t.firstByte)
+		},
+	}
+}
+
+func (t *tracer) set(field *time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	*field = time.Now()
+}
+
+func (t *tracer) done() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.bodyDone.IsZero() {
+		t.bodyDone = time.Now()
+	}
+}
+
+func (t *tracer) timings() Timings {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tm := Timings{
+		DNS:        span(t.dnsStart, t.dnsDone),
+		Connect:    span(t.connStart, t.connDone),
+		TLS:        span(t.tlsStart, t.tlsDone),
+		FirstByte:  span(t.start, t.firstByte),
+		Reused:     t.reused,
+		RemoteAddr: t.remoteAddr,
+	}
+	tm.Total = tm.FirstByte
+	if !t.bodyDone.IsZero() {
+		tm.Transfer = span(t.firstByte, t.bodyDone)
+		tm.Total = span(t.start, t.bodyDone)
+	}
+	return tm
+}
+
+func span(start, end time.Time) time.Duration {
+	if start.IsZero() || end.IsZero() || end.Before(start) {
+		return 0
+	}
+	return end.Sub(start)
+}
+
+// tracedBody records when the response body has been fully read or closed.
+type tracedBody struct {
+	io.ReadCloser
+	t *tracer
+}
+
+func (b tracedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == io.EOF {
+		b.t.done()
+	}
+	return n, err
+}
+
+func (b tracedBody) Close() error {
+	b.t.done()
+	return b.ReadCloser.Close()
+}
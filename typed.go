@@ -0,0 +1,93 @@
+package requests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// GetJSON sends a GET request and decodes the JSON response body into T.
+func GetJSON[T any](ctx context.Context, url string, opts ...Option) (T, *Response, error) {
+	return doJSON[T](ctx, do, http.MethodGet, url, opts)
+}
+
+// PostJSON encodes body as JSON, sends a POST request and decodes the JSON response body into Resp.
+func PostJSON[Req, Resp any](ctx context.Context, url string, body Req, opts ...Option) (Resp, *Response, error) {
+	return doJSON[Resp](ctx, do, http.MethodPost, url, withJSONBody(body, opts))
+}
+
+// PutJSON encodes body as JSON, sends a PUT request and decodes the JSON response body into Resp.
+func PutJSON[Req, Resp any](ctx context.Context, url string, body Req, opts ...Option) (Resp, *Response, error) {
+	return doJSON[Resp](ctx, do, http.MethodPut, url, withJSONBody(body, opts))
+}
+
+// PatchJSON encodes body as JSON, sends a PATCH request and decodes the JSON response body into Resp.
+func PatchJSON[Req, Resp any](ctx context.Context, url string, body Req, opts ...Option) (Resp, *Response, error) {
+	return doJSON[Resp](ctx, do, http.MethodPatch, url, withJSONBody(body, opts))
+}
+
+// DeleteJSON sends a DELETE request and decodes the JSON response body into T.
+func DeleteJSON[T any](ctx context.Context, url string, opts ...Option) (T, *Response, error) {
+	return doJSON[T](ctx, do, http.MethodDelete, url, opts)
+}
+
+// SessionGetJSON is GetJSON using session defaults.
+func SessionGetJSON[T any](ctx context.Context, s *Session, url string, opts ...Option) (T, *Response, error) {
+	return doJSON[T](ctx, s.do, http.MethodGet, url, opts)
+}
+
+// SessionPostJSON is PostJSON using session defaults.
+func SessionPostJSON[Req, Resp any](ctx context.Context, s *Session, url string, body Req, opts ...Option) (Resp, *Response, error) {
+	return doJSON[Resp](ctx, s.do, http.MethodPost, url, withJSONBody(body, opts))
+}
+
+// SessionPutJSON is PutJSON using session defaults.
+func SessionPutJSON[Req, Resp any](ctx context.Context, s *Session, url string, body Req, opts ...Option) (Resp, *Response, error) {
+	return doJSON[Resp](ctx, s.do, http.MethodPut, url, withJSONBody(body, opts))
+}
+
+// SessionPatchJSON is PatchJSON using session defaults.
+func SessionPatchJSON[Req, Resp any](ctx context.Context, s *Session, url string, body Req, opts ...Option) (Resp, *Response, error) {
+	return doJSON[Resp](ctx, s.do, http.MethodPatch, url, withJSONBody(body, opts))
+}
+
+// SessionDeleteJSON is DeleteJSON using session defaults.
+func SessionDeleteJSON[T any](ctx context.Context, s *Session, url string, opts ...Option) (T, *Response, error) {
+	return doJSON[T](ctx, s.do, http.MethodDelete, url, opts)
+}
+
+// doJSON sets Accept if missing, sends the request and decodes the response via Response.JSON.
+// On a status error the zero value is returned together with the response. Statuses outside
+// 2xx accepted with WithOKStatus or WithStatusValidator, such as a 404 meaning absent, and 204
+// responses return the zero value without error; other empty bodies fail with ErrResponse and
+// ErrNoContent.
+func doJSON[T any](ctx context.Context, send sendFunc, method, url string, opts []Option) (T, *Response, error) {
+	var out T
+	all := make([]Option, 0, len(opts)+1)
+	all = append(all, opts...)
+	all = append(all, withDefaultHeader("Accept", "application/json"))
+	resp, err := send(ctx, method, url, all...)
+	if err != nil {
+		return out, resp, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return out, resp, nil
+	}
+	if err := resp.JSON(&out); err != nil {
+		if errors.Is(err, ErrNoContent) {
+			if resp.StatusCode == http.StatusNoContent {
+				return out, resp, nil
+			}
+			err = fmt.Errorf("%w: %w", ErrResponse, err)
+		}
+		return out, resp, err
+	}
+	return out, resp, nil
+}
+
+func withJSONBody(body any, opts []Option) []Option {
+	all := make([]Option, 0, len(opts)+1)
+	all = append(all, opts...)
+	return append(all, WithJSON(body))
+}
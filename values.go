@@ -0,0 +1,253 @@
+package requests
+
+import (
+	"encoding"
+	"fmt"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+	timeType          = reflect.TypeFor[time.Time]()
+)
+
+// tagOptions holds the options parsed from a `url` struct tag.
+type tagOptions struct {
+	omitEmpty bool
+	comma     bool
+	brackets  bool
+	unix      bool
+	unixMilli bool
+	layout    string
+}
+
+// encodeValues encodes a struct into url.Values using `url:"name,opts"` tags.
+//
+// Supported tag options are omitempty, comma (join slice values with ","),
+// brackets (repeat slice values under "name[]"), unix and unixmilli (for time.Time).
+// A separate `layout:"..."` tag sets the time.Time layout; the default is RFC 3339.
+// Nested structs and maps are encoded as "parent[child]". Embedded structs without
+// a tag are flattened. Values implementing encoding.TextMarshaler are used as-is.
+func encodeValues(v any) (url.Values, error) {
+	out := make(url.Values)
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return out, nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("expected struct, got %T", v)
+	}
+	if err := encodeStruct(out, "", rv); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func encodeStruct(out url.Values, prefix string, rv reflect.Value) error {
+	rt := rv.Type()
+	for i := range rt.NumField() {
+		sf := rt.Field(i)
+		tag := sf.Tag.Get("url")
+		if tag == "-" {
+			continue
+		}
+		name, opts := parseTag(tag)
+		opts.layout = sf.Tag.Get("layout")
+		fv := rv.Field(i)
+
+		if sf.Anonymous && name == "" {
+			ev := fv
+			for ev.Kind() == reflect.Pointer && !ev.IsNil() {
+				ev = ev.Elem()
+			}
+			if ev.Kind() == reflect.Struct && !isTextValue(ev) {
+				if err := encodeStruct(out, prefix, ev); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		if prefix != "" {
+			name = prefix + "[" + name + "]"
+		}
+		if opts.omitEmpty && isEmptyValue(fv) {
+			continue
+		}
+		if err := encodeField(out, name, fv, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func encodeField(out url.Values, name string, v reflect.Value, opts tagOptions) error {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			out.Add(name, "")
+			return nil
+		}
+		v = v.Elem()
+	}
+	if isTextValue(v) {
+		s, err := formatValue(v, opts)
+		if err != nil {
+			return err
+		}
+		out.Add(name, s)
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		return encodeStruct(out, name, v)
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("field %s: unsupported map key type %s", name, v.Type().Key())
+		}
+		keys := v.MapKeys()
+		slices.SortFunc(keys, func(a, b reflect.Value) int { return strings.Compare(a.String(), b.String()) })
+		for _, k := range keys {
+			if err := encodeField(out, name+"["+k.String()+"]", v.MapIndex(k), opts); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			out.Add(name, string(v.Bytes()))
+			return nil
+		}
+		vals := make([]string, 0, v.Len())
+		for i := range v.Len() {
+			s, err := formatValue(v.Index(i), opts)
+			if err != nil {
+				return fmt.Errorf("field %s: %w", name, err)
+			}
+			vals = append(vals, s)
+		}
+		switch {
+		case opts.comma:
+			out.Add(name, strings.Join(vals, ","))
+		case opts.brackets:
+			out[name+"[]"] = append(out[name+"[]"], vals...)
+		default:
+			out[name] = append(out[name], vals...)
+		}
+		return nil
+	}
+
+	s, err := formatValue(v, opts)
+	if err != nil {
+		return fmt.Errorf("field %s: %w", name, err)
+	}
+	out.Add(name, s)
+	return nil
+}
+
+// formatValue formats a scalar, time.Time or encoding.TextMarshaler value.
+func formatValue(v reflect.Value, opts tagOptions) (string, error) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return "", nil
+		}
+		v = v.Elem()
+	}
+	if v.Type() == timeType {
+		t := v.Interface().(time.Time)
+		switch {
+		case opts.unix:
+			return strconv.FormatInt(t.Unix(), 10), nil
+		case opts.unixMilli:
+			return strconv.FormatInt(t.UnixMilli(), 10), nil
+		case opts.layout != "":
+			return t.Format(opts.layout), nil
+		default:
+			return t.Format(time.RFC3339), nil
+		}
+	}
+	if m, ok := textMarshaler(v); ok {
+		b, err := m.MarshalText()
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 32), nil
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64), nil
+	}
+	return "", fmt.Errorf("unsupported type %s", v.Type())
+}
+
+func isTextValue(v reflect.Value) bool {
+	if v.Type() == timeType {
+		return true
+	}
+	_, ok := textMarshaler(v)
+	return ok
+}
+
+func textMarshaler(v reflect.Value) (encoding.TextMarshaler, bool) {
+	if v.Type().Implements(textMarshalerType) {
+		m, ok := v.Interface().(encoding.TextMarshaler)
+		return m, ok
+	}
+	if v.CanAddr() && reflect.PointerTo(v.Type()).Implements(textMarshalerType) {
+		m, ok := v.Addr().Interface().(encoding.TextMarshaler)
+		return m, ok
+	}
+	return nil, false
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array, reflect.String:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+func parseTag(tag string) (string, tagOptions) {
+	var opts tagOptions
+	name, rest, _ := strings.Cut(tag, ",")
+	for opt := range strings.SplitSeq(rest, ",") {
+		switch strings.TrimSpace(opt) {
+		case "omitempty":
+			opts.omitEmpty = true
+		case "comma":
+			opts.comma = true
+		case "brackets":
+			opts.brackets = true
+		case "unix":
+			opts.unix = true
+		case "unixmilli":
+			opts.unixMilli = true
+		}
+	}
+	return name, opts
+}